@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// colorOutput enables ANSI color escapes in text output ("-color")
+var colorOutput bool
+
+// colors in the style of grep(1): SGR (Select Graphic Rendition) sequences
+const (
+	colorFile    = "\x1b[35m"     // magenta file names
+	colorLine    = "\x1b[32m"     // green line numbers, columns, and offsets
+	colorPattern = "\x1b[33m"     // yellow pattern that matched, of several
+	colorSep     = "\x1b[36m"     // cyan separators
+	colorMatch   = "\x1b[01;31m"  // bold red matches...
+	colorReset   = "\x1b[m\x1b[K" // reset and erase to end of line
+)
+
+// ...tinted by the class of the matching token
+var classColor = map[string]string{
+	"comment":     "\x1b[01;34m", // bold blue
+	"string":      "\x1b[01;33m", // bold yellow
+	"rune":        "\x1b[01;33m", // bold yellow
+	"code point":  "\x1b[01;33m", // bold yellow
+	"decoded":     "\x1b[01;33m", // bold yellow
+	"directive":   "\x1b[01;34m", // bold blue
+	"doc comment": "\x1b[01;34m", // bold blue
+	"import":      "\x1b[01;33m", // bold yellow
+	"tag":         "\x1b[01;33m", // bold yellow
+	"number":      "\x1b[01;36m", // bold cyan
+	"value":       "\x1b[01;36m", // bold cyan
+}
+
+// getColor decides whether to color output: "always", "never", or "auto" to
+// color only when writing to a terminal
+func getColor(mode string) (bool, error) {
+	switch strings.ToLower(mode) {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		file := os.Stdout
+		switch strings.ToLower(*flagOutput) {
+		case "", "[stdout]":
+		case "[stderr]":
+			file = os.Stderr
+		default:
+			return false, nil // named output files are not terminals
+		}
+		info, err := file.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid -color %q: use \"auto\", \"always\", or \"never\"", mode)
+}
+
+// paint writes s in color when color output is enabled
+func paint(b *bytes.Buffer, color, s string) {
+	if colorOutput {
+		b.WriteString(color)
+		b.WriteString(s)
+		b.WriteString(colorReset)
+	} else {
+		b.WriteString(s)
+	}
+}
+
+// separate writes a field separator, ':' for matches and '-' for context
+func separate(b *bytes.Buffer, sep byte) {
+	if colorOutput {
+		b.WriteString(colorSep)
+		b.WriteByte(sep)
+		b.WriteString(colorReset)
+	} else {
+		b.WriteByte(sep)
+	}
+}
+
+// matchColor is the color for the match in a token of the given class
+func matchColor(class string) string {
+	if color, ok := classColor[class]; ok {
+		return color
+	}
+	return colorMatch
+}
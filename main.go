@@ -17,18 +17,41 @@ import (
 )
 
 // common flags
+var flagAST = flag.String("ast", "", `search names of syntax nodes ("func,method,call,type,field,interface,label" or "all")`)
+var flagColor = flag.String("color", "auto", `color output ("auto", "always", or "never")`)
 var flagCPUs = flag.Int("cpu", -1, "number of CPUs to use (0 for all)")
 var flagGo = flag.Bool("go", true, `limit grep to Go files ("main.go")`)
+var flagJSON = flag.Bool("json", false, "write matches and summary as JSON Lines")
 var flagList = flag.String("list", "", "list of filenames to grep")
 var flagLog = flag.String("log", "", `write log to named file (or "[stdout]" or "[stderr]")`)
+var flagMaxTotal = flag.Int("max-total", 0, "stop after n matching lines in all files")
 var flagOutput = flag.String("output", "", `write output to named file (or "[stdout]" or "[stderr]")`)
 var flagRecursive = flag.Bool("r", false, "grep directories recursively")
+var flagSemantic = flag.String("semantic", "", `search type checked packages for an object ("def,ref,call,impl" or "all")`)
+var flagSequence = flag.Bool("seq", false, `match sequences of tokens ("k:go i: o:\(")`)
+var flagTolerance = flag.String("tolerance", "", `widen value searches ("1e-9", "0.01%", or "4ulp")`)
 var flagVisible = flag.Bool("visible", true, `limit grep to visible files (skip ".hidden.go")`)
 
 // grep-compatibility flags
 var flagActLikeGrep = flag.Bool("g", false, "act like grep")
+var flagAfter = flag.Int("A", 0, "display n lines of context after each match")
+var flagBefore = flag.Int("B", 0, "display n lines of context before each match")
+var flagContext = flag.Int("C", 0, "display n lines of context around each match")
+var flagCount = flag.Bool("c", false, "display count of matching lines for each file")
+var flagFilesWith = flag.Bool("l", false, "display names of files with matches")
+var flagFilesWithout = flag.Bool("L", false, "display names of files without matches")
+var flagByteOffset = flag.Bool("b", false, "display byte offset of each match")
+var flagColumn = flag.Bool("column", false, "display column number of each match")
 var flagFileName = flag.Bool("h", false, `disply file name ("header") for each match`)
+var flagFixed = flag.Bool("F", false, "match pattern as a fixed string")
+var flagIgnoreCase = flag.Bool("i", false, "ignore case distinctions in matches")
 var flagLineNumber = flag.Bool("n", false, "disply line number for each match")
+var flagPatternFile = flag.String("f", "", "search patterns listed one per line in file")
+var flagPatterns = patternFlag("e", `search pattern, repeatable, with optional class prefix ("c:TODO")`)
+var flagMaxCount = flag.Int("m", 0, "stop scanning each file after n matching lines")
+var flagQuiet = flag.Bool("q", false, "quiet: print nothing, stop at first match")
+var flagInvert = flag.Bool("v", false, "display lines that do not match")
+var flagWord = flag.Bool("w", false, "match whole words (whole identifiers and keywords)")
 
 // secret developer flags
 var flagBufferSize = flag.Int("bufferSize", 64*1024, "output buffer size")
@@ -47,36 +70,81 @@ var usage = `NAME
     gg - grep Go-language source code
 
 SYNOPSIS
-    gg [options] acdiknoprstvg regexp [file ...]
+    gg [options] acdefikmnopqrstuvwxyzg regexp [file ...]
+    gg [options] -e regexp ... acdefikmnopqrstuvwxyzg [file ...]
+    gg [options] -ast kinds regexp [file ...]
+    gg [options] -semantic relations object [package ...]
+    gg [options] -seq sequence [file ...]
 
 DESCRIPTION
     gg is classic grep (g/RE/p) with flag-directed Go token focus to search
     in package names, numbers, identifiers, comments, keywords, and more.
-    Token flags are "acdiknoprstvg" in any order or combination:
+    Token flags are "acdefikmnopqrstuvwxyzg" in any order or combination:
 
-       a   search in All of the following
+       a   search in All of the following but f, m, q, w, x, y, and z
        c   search in Comments (//... or /*...*/)
        d   search in Defined non-types (iota, nil, new, true,...)
-       i   search in Identifiers ([alphabetic][alphabetic | numeric]*)
+       e   search in identifiers where dEclared (func f, var x, x :=, params)
+       f   search in struct Field tags (json:omitempty, db:^user_)
+       i   search in Identifiers ([alphabetic][alphabetic | numeric]*), with e
        k   search in Keywords (if, for, func, go, ...)
+       m   search in Magic comments, directives (go:embed, nolint, #cgo)
        n   search in Numbers ("255" matches 255, 0.255, 1e255)
        o   search in Operators (,  +  -  *  /  [  ] {  }  ( )  >>...)
        p   search in Package names
+       q   search in string values, decoded ("\x41BC" matches ^ABC$)
        r   search in Rune literals ('a', '\U00101234')
        s   search in Strings (quoted or raw)
        t   search in Types (bool, int, float64, map, ...)
+       u   search in rune literals by code point ('A' is '\x41', '\101')
        v   search in Values (255 is 0b11111111, 0377, 255, 0xff)
+       w   search in comments other than doc comments, Within code
+       x   search in selectors, X.Sel, by package path ("net/http.Get")
+       y   search in doc comments (before package, func, type, var, const)
+       z   search in import paths and aliases ("_ ." finds blank imports)
        g   search as grep, perform simple line-by-line matches in file
 
     gg combines lexical analysis and Go-native pattern matching to extend
     grep(1) for Go developers.  The search is restricted, seeking matches
     only in chosen token classes.  A search in number literals can match
     values, "v 255" matches the numeric value 255 in source code as
-    0b1111_1111, 0377, 0o377, 255, 0xff, etc.  Go's linear-time regular
-    expression engine is Unicode-aware and supports many Perl extensions:
-    numbers in identifiers are found with "gg i [0-9]" or "gg i [\d]",
-    comments with math symbols by "gg c \p{Sm}", and Greek in strings via
-    "gg s \p{Greek}" each with appropriate shell escaping.
+    0b1111_1111, 0377, 0o377, 255, 0xff, etc.  Values may also be sought by
+    comparison, ">=1e6"; by inclusive range, "1024..65535", with either end
+    optional; as nonzero multiples, "%4096"; by rounding, "~3.14159"
+    matching 3.141592653589793 but not 3.1416; or in a set of any of these,
+    "{8080,8443}".  Values are exact, so every spelling of a number matches:
+    "v 0.25" finds .25, 25e-2, and 0x1p-2, "v 255" finds 255.0, and
+    integers beyond 64 bits are found too.  See "-tolerance" for nearby
+    values.  Imaginary values such as "v 2i" match imaginary literals.
+    Negative values match literals with a unary minus sign: "v -1" matches
+    "x := -1" and "return -0x1" but not the subtraction "n-1".  Rune
+    literals are found by code point in the same way: "u A" matches 'A',
+    '\x41', '\101', and '\u0041'.  Code points may be written as a
+    character, a rune literal, or "U+0041"; in inclusive ranges, "a..z";
+    as Unicode classes, "\p{Cyrillic}" or "\pN"; or in sets,
+    "{A..F,a..f}".  String literals are found by their decoded values,
+    without quotes and with escapes interpreted, so "q ^ABC$" matches
+    "\x41BC" and the raw string ABC; each line of a multi-line raw string
+    is matched on its own.  Struct field tags are found by key and value as
+    reflect.StructTag reads them: "f json:omitempty" matches the tag
+    json:"name,omitempty" and "f db:^user_" those with db values that begin
+    with user_; a pattern without a key matches the whole tag.  Directive
+    comments such as //go:generate, //go:build, // +build, //nolint, and
+    #cgo lines are found by name and, after a space, arguments:
+    "m go:linkname" lists every linkname and "m 'go:embed \.html$'" the
+    embedded HTML, without the prose that mentions them.  Comments are
+    divided into doc comments, the groups directly before package, func,
+    type, var, and const declarations, and the rest: "y Deprecated:" finds
+    deprecation notices while "w" searches inline and implementation
+    comments, commented-out code among them.  Imports are found by path,
+    unquoted, or by alias and path as written in Go: "z ^unsafe$" finds
+    imports of unsafe, "z '_ .'" blank imports, and "z golang.org/x/..."
+    imports of any package of that module.  Go's
+    linear-time regular expression engine is Unicode-aware and supports
+    many Perl extensions: numbers in identifiers are found with
+    "gg i [0-9]" or "gg i [\d]", comments with math symbols by
+    "gg c \p{Sm}", and Greek in strings via "gg s \p{Greek}" each with
+    appropriate shell escaping.
 
     gg searches files names listed on the command line or in a file of
     filenames provided the "-list" argument.  If neither of these is
@@ -94,10 +162,77 @@ DESCRIPTION
     scanning each Go source file or archive in that directory's hierarchy.
 
 OPTIONS
+    -A=n, -B=n, -C=n
+        Display n lines of context After, Before, or both before and after
+        ("Context") each matching line. Context lines are marked with "-"
+        rather than ":" after the file name and line number, and a line
+        of "--" separates groups of lines that are not adjacent. Context
+        shared by nearby matches is shown once. "-A" and "-B" override
+        "-C". Default is 0.
+
+    -ast=kinds
+        Search the names of Go syntax nodes, as parsed by go/parser,
+        rather than tokens.  The token class argument is omitted:
+        "gg -ast call,method Scan ." finds calls and methods named Scan.
+        Kinds, in a comma-separated list or "all", are "func" for
+        function names; "method" for method names qualified by receiver
+        type, as in "Searcher.Scan"; "call" for the functions called, as
+        written, "fmt.Println"; "type" for type names; "field" for struct
+        field names; "interface" for interface method names; and "label"
+        for labels.  Matches are named by kind.  Files that do not parse
+        are searched as identifiers.  Default is none, token search.
+
+    -b=bool
+        Display the byte offset of each match, counting from zero at the
+        start of the file, after the line and column numbers. The offset
+        is that of the matching token or, within multi-line raw strings
+        and block comments, of the match in that line.  Default is false.
+
+    -c=bool
+        Display only the count of matching lines in each file, as
+        "file:count". Default is false.
+
+    -color=when
+        Color file names, line numbers, and the matching text within each
+        line when "always", never when "never", or only when output is
+        to a terminal when "auto". Matches are tinted by the class of the
+        matching token: comments blue, strings and runes yellow, numbers
+        and values cyan, and others red. Default is "auto".
+
+    -column=bool
+        Display the column of each match, counting bytes from one, after
+        the line number. The column is that of the matching token or,
+        within multi-line raw strings and block comments, of the match
+        in that line.  Default is false.
+
     -cpu=n
         Set the number of CPUs to use. Negative n means "all but n."
         Default is all.
 
+    -e=regexp
+        Search for regexp, which may be a pattern of several given by
+        repeated "-e" options. A pattern may begin with token class flags
+        and a colon to search those classes rather than the default ones
+        named before the files: "gg -e c:TODO -e i:^Deprecated a ." finds
+        TODO in comments and Deprecated identifiers.  A prefix begins with
+        a lower-case letter and names each class once, so "TODO:" is text,
+        not classes.  An empty prefix, as in ":std:x", keeps the default
+        classes.  The regexp argument is
+        omitted when patterns are given by "-e" or "-f".  With several
+        patterns, output names the one that matched after the line and
+        column numbers, and a line matching more than one is reported
+        once.
+
+    -f=file
+        Search for the patterns listed one per line in the named file, as
+        if each were given by "-e".  Blank lines are ignored, and a file
+        with no patterns is an error.
+
+    -F=bool
+        Match the pattern as a fixed string rather than a regular
+        expression, so "fmt.Println" matches only itself.  Default is
+        false.
+
     -go=bool
         Limit search to ".go" files.  Default is true.
 
@@ -105,6 +240,29 @@ OPTIONS
         Display file names ("headers") on matches.  Default is false for
         single-file searches and true otherwise.
 
+    -i=bool
+        Ignore case distinctions, as if the pattern began with "(?i)".
+        Default is false.
+
+    -json=bool
+        Write each match as a JSON object on its own line (JSON Lines)
+        rather than as text. Match objects have "type" of "match" and give
+        the "file", archive "member" (if any), "line", "column", byte
+        "offset", token "class", lexer "subtype", matching "token", and
+        the line's "text". With "-c", "-l", or "-L" objects of "type"
+        "file" give the "file", "member", and "count" of matching lines.
+        A final object of "type" "summary" gives the counts of "bytes",
+        "tokens", "matches", "lines", and "files" searched. Default is
+        false.
+
+    -l=bool
+        Display only the names of files with matches, one per line. The
+        scan of each file stops at its first match. Default is false.
+
+    -L=bool
+        Display only the names of files without matches, one per line.
+        Default is false.
+
     -list=file
         Search files listed one per line in the named file.
 
@@ -113,6 +271,15 @@ OPTIONS
         file names "[stdout]" and "[stderr]" refer to the stdout and
         stderr streams.  (Last line of log details efficiency.)
 
+    -m=n
+        Stop scanning each file after n matching lines. Default is 0, no
+        limit.
+
+    -max-total=n
+        Stop the search after n matching lines in all files. Scans in
+        progress are abandoned and files not yet scanned are skipped.
+        Default is 0, no limit.
+
     -n=bool
         Display line numbers following each match. Numbers count from
         one per file.  Default is false.
@@ -122,19 +289,75 @@ OPTIONS
         file.  The special names "[stdout]" and "[stderr]" refer to the
         stdout and stderr streams.
 
+    -q=bool
+        Quiet: print nothing and stop at the first match. The exit status
+        tells whether any match was found.  Default is false.
+
     -r=bool
         Search directories recursively.  Default is false.
 
+    -semantic=relations
+        Search type checked packages for uses of one object rather than
+        tokens matching a pattern.  The token class argument is omitted,
+        the pattern names the object, and the files are replaced by
+        package patterns as for the go command, "." by default:
+        "gg -semantic call '(*os.File).Close' ./..." finds calls of Close
+        on *os.File but not on other types.  Objects are package-level,
+        "os.Open" or "io.Reader", or methods and fields of a type,
+        "os.File.Close", with the package named by import path or omitted
+        for the packages searched, "Searcher.Scan".  Relations, in a
+        comma-separated list or "all", are "def" for the definition,
+        "ref" for references, "call" for calls, and "impl" for the types
+        and methods that implement an interface or interface method.
+        Packages and their tests are loaded with the package
+        golang.org/x/tools/go/packages from local source and the module
+        cache, offline, unless GOFLAGS or GOPROXY are set.  Default is
+        none, token search.
+
+    -seq=bool
+        Match runs of adjacent tokens, ignoring space and comments, rather
+        than single tokens.  The token class argument is omitted, and the
+        pattern is a list of words each matching a token: "classes:regexp"
+        a token of the classes, by flag letters, whose whole text matches
+        the regexp; "classes:" any token of the classes; or "_" any token.
+        A word may be followed by a repetition, "?", "*", "+", "{m}",
+        "{m,}", or "{m,n}", that matches as few tokens as it can.
+        "gg -seq 'k:go i: o:\(' ." finds goroutines started by calling a
+        named function, and "gg -seq 'k:defer _ {0,8} d:recover' ." deferred
+        recovery.  Default is false.
+
+    -tolerance=list
+        Widen value searches for a number to nearby literals: within a
+        distance, "1e-9"; within a percentage of the number, "0.01%"; or
+        within units in the last place of the number as a float64,
+        "4ulp".  In a comma-separated list, "1e-9,4ulp", the widest
+        applies.  Ranges, comparisons, and other value queries are not
+        widened.  Default is none, exact values.
+
+    -v=bool
+        Invert the search. In grep mode, display lines that do not match.
+        Otherwise display lines having tokens of the selected classes of
+        which none match: "gg -v s ^\"msg\." ." finds lines with string
+        literals, none of them in that message key format.  Default is
+        false.
+
     -visible=bool
         Restrict search to visible files, those with names that do not
         start with "." (in the shell tradition).  Default is true.
 
-    acdiknoprstvCDIKNOPRSTVg
+    -w=bool
+        Match whole words only. In identifiers and keywords the whole
+        token must match: "gg -w i Print" finds Print but not Println.
+        A literal pattern is compared to such tokens directly, without
+        the regular expression engine.  Default is false.
+
+    acdefikmnopqrstuvwxyzCDEFIKMNOPQRSTUVWXYZg
         The Go token class flags have an upper case negative form to
         disable the indicated class.  Used with "a" for "all", "aCS"
-        means "search All tokens except Comments and Strings."  Flag "g"
-        means search as if the grep command, ignore Go lexical analysis
-        and match lines.
+        means "search All tokens except Comments and Strings."  Since "i"
+        includes "e", "iE" means "search identifiers where they are used,
+        not where they are declared."  Flag "g" means search as if the
+        grep command, ignore Go lexical analysis and match lines.
 
 EXAMPLES
     To search for comments containing "case" (ignoring switch statements)
@@ -161,6 +384,27 @@ SEE ALSO
     https://en.wikipedia.org/wiki/Unicode_character_property
 `
 
+// patternList is the value of a repeatable flag
+type patternList []string
+
+func (p *patternList) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, " ")
+}
+
+func (p *patternList) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+func patternFlag(name, usage string) *patternList {
+	p := new(patternList)
+	flag.Var(p, name, usage)
+	return p
+}
+
 func main() {
 	// parse command line to allow access to profiling options in doProfile()
 	flag.Usage = func() {
@@ -248,8 +492,8 @@ func doMain() int {
 	// 	*flagActLikeGrep = true // if user's made a symlink or renamed, become grep
 	// }
 
-	if flag.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "usage: gg [flags] acdiknoprstvg regexp [file ...]\n")
+	if flag.NArg() < 1 && len(*flagPatterns) == 0 && *flagPatternFile == "" {
+		fmt.Fprintf(os.Stderr, "usage: gg [flags] acdefikmnopqrstuvwxyzg regexp [file ...]\n")
 		fmt.Fprintf(os.Stderr, "    gg -help for details\n")
 		return 2 // failure: (like grep: return 2 instead of 1)
 	}
@@ -266,10 +510,10 @@ func doMain() int {
 
 	// print performance summary
 	if *flagLog != "" {
-		s.print(elapsed, user, system, printf) // print to log
+		printSummary(s, elapsed, user, system, printf) // print to log
 	}
 	if *flagSummary {
-		s.print(elapsed, user, system, func(f string, v ...interface{}) {
+		printSummary(s, elapsed, user, system, func(f string, v ...interface{}) {
 			_, _ = fmt.Printf(f, v...) // print to stdout
 		})
 	}
@@ -280,9 +524,9 @@ func doMain() int {
 	case err != nil:
 		printf("error: %v", err)
 		programStatus = 2 // program failure: (like grep)
-	case s.matches <= 0:
+	case s.Matches <= 0:
 		programStatus = 1 // search unsuccessful: no match; handy in shell "&&" constructs
-	default: // err==nil && s.matches>=1
+	default: // err==nil && s.Matches>=1
 		programStatus = 0 // search successful: 1 or more matches
 	}
 	return programStatus
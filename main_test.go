@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/MichaelTJones/gg/search"
 )
 
 func Test_getMaxCPU(t *testing.T) {
@@ -49,3 +55,234 @@ func Test_getMaxCPU(t *testing.T) {
 		})
 	}
 }
+
+func Test_getOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		quiet     bool
+		filesWith bool
+		context   int
+
+		want1 search.Options
+	}{
+		{
+			name:  "quiet stops at the first match",
+			quiet: true,
+			want1: search.Options{MaxTotal: 1},
+		},
+
+		{
+			name:      "files with matches stop at the first in each",
+			filesWith: true,
+			want1:     search.Options{MaxCount: 1},
+		},
+
+		{
+			name:    "context before and after",
+			context: 2,
+			want1:   search.Options{Before: 2, After: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*flagQuiet, *flagFilesWith, *flagContext = tt.quiet, tt.filesWith, tt.context
+			defer func() { *flagQuiet, *flagFilesWith, *flagContext = false, false, 0 }()
+			got := getOptions([]string{"x"}, 1)
+			got1 := search.Options{MaxTotal: got.MaxTotal, MaxCount: got.MaxCount, Before: got.Before, After: got.After}
+
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("getOptions got1 = %+v, want1: %+v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_formatFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		count        int
+		flagCount    bool
+		filesWith    bool
+		filesWithout bool
+
+		want1 string
+	}{
+		{
+			name:      "-c",
+			count:     3,
+			flagCount: true,
+			want1:     "a.go:3\n",
+		},
+
+		{
+			name:      "-c with no match",
+			flagCount: true,
+			want1:     "a.go:0\n",
+		},
+
+		{
+			name:      "-l",
+			count:     1,
+			filesWith: true,
+			want1:     "a.go\n",
+		},
+
+		{
+			name:      "-l with no match",
+			filesWith: true,
+			want1:     "",
+		},
+
+		{
+			name:         "-L",
+			filesWithout: true,
+			want1:        "a.go\n",
+		},
+
+		{
+			name:         "-L with a match",
+			count:        1,
+			filesWithout: true,
+			want1:        "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*flagCount, *flagFilesWith, *flagFilesWithout = tt.flagCount, tt.filesWith, tt.filesWithout
+			defer func() { *flagCount, *flagFilesWith, *flagFilesWithout = false, false, false }()
+			b := new(bytes.Buffer)
+			formatFile(b, "a.go", tt.count)
+
+			if got1 := b.String(); got1 != tt.want1 {
+				t.Errorf("formatFile got1 = %q, want1: %q", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_formatGroup(t *testing.T) {
+	match := search.Match{Line: 5, Text: "match",
+		Before: []search.Line{{Line: 4, Text: "before"}},
+		After:  []search.Line{{Line: 6, Text: "after"}}}
+	tests := []struct {
+		name     string
+		printed  bool
+		lastLine int
+
+		want1 string
+		want2 int
+	}{
+		{
+			name:  "first group",
+			want1: "a.go-4-before\na.go:5:match\na.go-6-after\n",
+			want2: 6,
+		},
+
+		{
+			name:     "adjacent group",
+			printed:  true,
+			lastLine: 3,
+			want1:    "a.go-4-before\na.go:5:match\na.go-6-after\n",
+			want2:    6,
+		},
+
+		{
+			name:     "separated group",
+			printed:  true,
+			lastLine: 2,
+			want1:    "--\na.go-4-before\na.go:5:match\na.go-6-after\n",
+			want2:    6,
+		},
+
+		{
+			name:     "group in another file",
+			printed:  true,
+			lastLine: -1,
+			want1:    "--\na.go-4-before\na.go:5:match\na.go-6-after\n",
+			want2:    6,
+		},
+	}
+
+	*flagLineNumber = true
+	defer func() { *flagLineNumber = false }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			got2 := formatGroup(b, "a.go", match, tt.printed, tt.lastLine)
+
+			if got1 := b.String(); got1 != tt.want1 || got2 != tt.want2 {
+				t.Errorf("formatGroup got = %q, %d, want: %q, %d", got1, got2, tt.want1, tt.want2)
+			}
+		})
+	}
+}
+
+func Test_formatJSON(t *testing.T) {
+	b := new(bytes.Buffer)
+	formatJSON(b, "a.tar::x.go", search.Match{Line: 3, Column: 2, Offset: 20, Class: "identifier", Token: "x", Text: " x", Start: 1, End: 2})
+	*flagJSON, *flagCount = true, true
+	formatFile(b, "y.go", 2)
+	*flagJSON, *flagCount = false, false
+	formatJSONSummary(b, search.Summary{Bytes: 100, Tokens: 30, Matches: 3, Lines: 9, Files: 2})
+
+	want := []map[string]interface{}{
+		{"type": "match", "file": "a.tar", "member": "x.go", "line": 3.0, "column": 2.0, "offset": 20.0, "class": "identifier", "subtype": 0.0, "token": "x", "text": " x", "start": 1.0, "end": 2.0},
+		{"type": "file", "file": "y.go", "count": 2.0},
+		{"type": "summary", "bytes": 100.0, "tokens": 30.0, "matches": 3.0, "lines": 9.0, "files": 2.0},
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("formatJSON wrote %d lines, want %d: %q", len(lines), len(want), b.String())
+	}
+	for i, line := range lines {
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v: %s", i+1, err, line)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d got = %v, want: %v", i+1, got, want[i])
+		}
+	}
+}
+
+func Test_getColor(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	stdout := os.Stdout
+	os.Stdout = w // not a terminal
+	defer func() { os.Stdout = stdout }()
+
+	tests := []struct {
+		name   string
+		mode   string
+		output string
+
+		want1 bool
+		err   bool
+	}{
+		{name: "auto to a pipe", mode: "auto", want1: false},
+		{name: "default to a pipe", mode: "", want1: false},
+		{name: "auto to a file", mode: "auto", output: "out.txt", want1: false},
+		{name: "always", mode: "always", want1: true},
+		{name: "never", mode: "never", want1: false},
+		{name: "invalid", mode: "sometimes", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*flagOutput = tt.output
+			defer func() { *flagOutput = "" }()
+			got1, err := getColor(tt.mode)
+
+			if got1 != tt.want1 || (err != nil) != tt.err {
+				t.Errorf("getColor(%q) got = %v, %v, want: %v, error %v", tt.mode, got1, err, tt.want1, tt.err)
+			}
+		})
+	}
+}
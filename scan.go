@@ -3,116 +3,135 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"compress/bzip2"
-	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 
-	"launchpad.net/gommap"
-
-	"github.com/MichaelTJones/lex"
-	// "github.com/MichaelTJones/walk"
-	"github.com/klauspost/compress/zstd"
-	// "github.com/mirtchovski/walk"
+	"github.com/MichaelTJones/gg/search"
 )
 
 /*
 Go-Grep: scan any number of Go source code files, where scanning means passing each
 through Go-language lexical analysis and reporting lines where selected classes of
-tokens match a search pattern defined by a reguar expression.
+tokens match a search pattern defined by a reguar expression. The work is done by
+package search; this file adapts it to the command line.
 */
 
-// token class inclusion
-// a: search all of the following
-// c: search Comments ("//..." or "/*...*/")
-// d: search Defined non-types (iota, nil, new, true,...)
-// i: search Identifiers ([a-zA-Z][a-zA-Z0-9]*)
-// k: search Keywords (if, for, func, go, ...)
-// n: search Numbers as strings (255 as 255, 0.255, 1e255)
-// o: search Operators (,+-*/[]{}()>>...)
-// p: search Package names
-// r: search Rune literals ('a', '\U00101234')
-// s: search Strings ("quoted" or `raw`)
-// t: search Types (bool, int, float64, map, ...)
-// v: search numeric Values (255 as 0b1111_1111, 0377, 255, 0xff)
-var G, C, D, I, K, N, O, P, R, S, T, V bool
-
-var dispatch = []*bool{nil, nil, &C, &I, &K, &O, &R, nil, &S, &T, &D, &N, nil}
-
-// matching
-var regex *regexp.Regexp // pattern
-
-// warning: do not use negative numbers in value matches. the code here is fine and ready,
-// bbut the lexer does not (can not) decide when a "-" is a prefix negative sign vs when
-// it is a subtraction operator, That's the job of the parser. we can add a mini-parser
-// for this, but for now, just don't enter negative values on ghe command line.
-var sign int       // literal sign
-var vIsInt bool    // is number literal an int or floating point
-var vInt uint64    // literal value
-var vFloat float64 // literal value
-
-type Scan struct {
-	regex    *regexp.Regexp
-	path     []byte
-	Summary  // accumulator: bytes, tokens, lines, matches
-	complete bool
-	total    Summary
-	report   []byte
-}
+// tokenFlags are the letters that name token classes
+const tokenFlags = "acdefikmnopqrstuvwxyzCDEFIKMNOPQRSTUVWXYZg"
 
-func NewScan() *Scan {
-	return &Scan{}
-}
+func doScan() (search.Summary, error) {
+	patterns, err := getPatterns()
+	if err == nil && len(patterns) == 0 && *flagPatternFile != "" {
+		err = errors.New("no patterns in " + *flagPatternFile) // not the first file
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return search.Summary{}, err
+	}
 
-func doScan() (Summary, error) {
-	s := NewScan()
 	fixedArgs := 2
 	if *flagActLikeGrep {
 		fixedArgs = 1
+	} else if *flagAST != "" || *flagSemantic != "" || *flagSequence {
+		fixedArgs-- // these modes search other than token classes
+	}
+	if len(patterns) > 0 {
+		fixedArgs-- // patterns are given by options rather than argument
 	}
 
 	if flag.NArg() < fixedArgs {
-		return Summary{}, errors.New("not enough arguments: missing keywords and pattern")
+		return search.Summary{}, errors.New("not enough arguments: missing keywords and pattern")
+	}
+
+	// gg mode
+	opt := getOptions(patterns, fixedArgs)
+	context := opt.Before > 0 || opt.After > 0
+	files := *flagCount || *flagFilesWith || *flagFilesWithout
+
+	if colorOutput, err = getColor(*flagColor); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return search.Summary{}, err
+	}
+	if !*flagActLikeGrep && *flagAST == "" && *flagSemantic == "" && !*flagSequence {
+		opt.Classes = flag.Arg(0)
+		if len(patterns) > 0 && strings.Trim(opt.Classes, tokenFlags) != "" {
+			// "gg -e c:print a.go" lacks the classes before the files
+			err := fmt.Errorf("token classes must precede the files when patterns are given by -e or -f, not %q", opt.Classes)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return search.Summary{}, err
+		}
+	}
+	if *flagLog != "" {
+		opt.Logf = log.Printf
 	}
 
-	// initialize regular expression matcher
-	var err error
-	regex, err = getRegexp(flag.Arg(fixedArgs - 1))
+	w, flush, err := getOutput()
 	if err != nil {
-		return Summary{}, err
+		return search.Summary{}, err
 	}
+	buf := new(bytes.Buffer)
+	printed := false // any line printed yet
+	lastLine := 0    // last line number printed in this file
+	report := func(r *search.Result) {
+		if *flagQuiet {
+			return
+		}
 
-	// gg mode
-	mode := setupModeGG(flag.Args())
-	C = mode.C
-	D = mode.D
-	G = mode.G
-	I = mode.I
-	K = mode.K
-	N = mode.N
-	O = mode.O
-	P = mode.P
-	R = mode.R
-	S = mode.S
-	T = mode.T
-	V = mode.V
-	vIsInt = mode.vIsInt
-	vInt = mode.vInt
-	vFloat = mode.vFloat
+		// report all matching lines in file
+		buf.Reset()
+		if files {
+			// report files rather than lines
+			if r.Summary.Files > 0 {
+				formatFile(buf, r.Name, len(r.Matches))
+				w.Write(buf.Bytes())
+			}
+			return
+		}
+		lastLine = -1 // no line is adjacent to lines of another file
+		for _, m := range r.Matches {
+			switch {
+			case *flagJSON:
+				formatJSON(buf, r.Name, m)
+			case context:
+				lastLine = formatGroup(buf, r.Name, m, printed, lastLine)
+				printed = true
+			default:
+				formatMatch(buf, r.Name, m)
+			}
+		}
+		w.Write(buf.Bytes())
+	}
+
+	// initialize searcher and its regular expression matcher
+	s, err := search.New(opt, report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return search.Summary{}, err
+	}
 
 	println("scan begins")
 	scanned := false
 
+	// load and scan packages named on command line in semantic mode
+	semantic := *flagSemantic != "" && !*flagActLikeGrep
+	if semantic {
+		println("processing packages listed on command line")
+		*flagFileName = true // packages have many files...print names
+		if err := s.Packages(flag.Args()[fixedArgs:]...); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return search.Summary{}, err
+		}
+		scanned = true
+	}
+
 	// scan files in the file of filenames indicated by the "-list" option.
 	if *flagList != "" {
 		println("processing files listed in the -list option")
@@ -122,7 +141,7 @@ func doScan() (Summary, error) {
 	}
 
 	// scan files named on command line.
-	if flag.NArg() > fixedArgs {
+	if flag.NArg() > fixedArgs && !semantic {
 		println("processing files listed on command line")
 		if flag.NArg() > fixedArgs+1 {
 			*flagFileName = true // multiple files...print names
@@ -143,304 +162,140 @@ func doScan() (Summary, error) {
 		}
 	}
 	summary := s.Complete() // parallel rendevousz here...waits for completion
+	if *flagJSON && !*flagQuiet {
+		buf.Reset()
+		formatJSONSummary(buf, summary)
+		w.Write(buf.Bytes())
+	}
+	flush()
 	println("scan ends")
 	return summary, nil
 }
 
-func isVisible(name string) bool {
-	if *flagVisible {
-		for _, s := range strings.Split(name, string(os.PathSeparator)) {
-			if s != "" && s != "." && s != ".." && s[0] == '.' {
-				return false
-			}
-		}
-	}
-	return true
-}
-
-func isGo(name string) bool {
-	if !*flagGo {
-		return true
-	}
-	if isCompressed(name) {
-		ext := filepath.Ext(name)
-		name = strings.TrimSuffix(name, ext) // unwrap the compression suffix
-	}
-	return filepath.Ext(name) == ".go"
-}
-
-func isArchive(name string) bool {
-	if isCompressed(name) {
-		ext := filepath.Ext(name)
-		name = strings.TrimSuffix(name, ext) // unwrap the compression suffix
-	}
-	ext := filepath.Ext(name)
-	return ext == ".cpio" || ext == ".tar" || ext == ".zip"
-}
-
-func isBinary(source []byte) bool {
-	const byteLimit = 2 * 1024
-	const nonPrintLimit = 8 + 1 // one Unicode byte order mark is forgiven
-	nonPrint := 0
-	for i, c := range source {
-		if i > byteLimit {
-			break
+// getOptions returns the search options set by the command line flags, with
+// the pattern, when not given by "-e" or "-f", the last of the fixed args
+func getOptions(patterns []string, fixedArgs int) search.Options {
+	opt := search.Options{
+		Patterns:   patterns,
+		Grep:       *flagActLikeGrep,
+		AST:        *flagAST,
+		Semantic:   *flagSemantic,
+		Sequence:   *flagSequence,
+		IgnoreCase: *flagIgnoreCase,
+		Fixed:      *flagFixed,
+		Word:       *flagWord,
+		Tolerance:  *flagTolerance,
+		Invert:     *flagInvert,
+		Recursive:  *flagRecursive,
+		AllFiles:   !*flagGo,
+		Hidden:     !*flagVisible,
+		NoMap:      !*flagMap,
+		Before:     *flagBefore,
+		After:      *flagAfter,
+		MaxCount:   *flagMaxCount,
+		MaxTotal:   *flagMaxTotal,
+		Ordered:    !*flagUnordered,
+		Workers:    *flagCPUs,
+	}
+	if len(patterns) == 0 {
+		opt.Pattern = flag.Arg(fixedArgs - 1)
+	}
+	if opt.Before == 0 {
+		opt.Before = *flagContext
+	}
+	if opt.After == 0 {
+		opt.After = *flagContext
+	}
+	if *flagFilesWith || *flagFilesWithout {
+		opt.MaxCount = 1 // one match settles the question
+	}
+	if *flagQuiet {
+		opt.MaxTotal = 1 // only the exit status matters
+	}
+	return opt
+}
+
+// getPatterns gathers the patterns of "-e" options and those listed one per
+// line in the file named by the "-f" option, ignoring blank lines
+func getPatterns() ([]string, error) {
+	patterns := append([]string(nil), *flagPatterns...)
+	if *flagPatternFile != "" {
+		file, err := os.Open(*flagPatternFile)
+		if err != nil {
+			return nil, err
 		}
-		if c < 32 && c != ' ' && c != '\n' && c != '\t' {
-			nonPrint++
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				patterns = append(patterns, line)
+			}
 		}
-		if nonPrint > nonPrintLimit {
-			return true
+		if err := scanner.Err(); err != nil {
+			return nil, err
 		}
 	}
-	return false
+	return patterns, nil
 }
 
-func isCompressed(name string) bool {
-	ext := filepath.Ext(name)
-	return ext == ".bz2" || ext == ".gz" || ext == ".zst"
-}
-
-func decompress(oldName string, oldData []byte) (newName string, newData []byte, mapped bool, err error) {
-	ext := filepath.Ext(oldName)
-	if (ext == ".go" && len(oldData) > 0) || (ext == ".zip") {
-		return oldName, oldData, false, nil // nothing to do
-	}
-	if *flagMap && ext == ".go" {
-		file, err := os.Open(oldName)
-		if err == nil {
-			mmap, err := gommap.Map(file.Fd(), gommap.PROT_READ, gommap.MAP_PRIVATE)
-			if err == nil {
-				err = mmap.Advise(gommap.MADV_SEQUENTIAL | gommap.MADV_WILLNEED)
-				// fmt.Printf("mmaped: %q len=%d head=%q\n", oldName, len(mmap), mmap[:32])
-				file.Close()
-				return oldName, []byte(mmap), true, err
-			}
+// getOutput opens the destination named by the "-output" option. The returned
+// flush function completes any buffered writes.
+func getOutput() (w io.Writer, flush func(), err error) {
+	var b *bufio.Writer
+	flush = func() {
+		if b != nil {
+			b.Flush()
 		}
 	}
 
-	var oldSize int64
-	var encoded, decoder io.Reader
-
-	// Select source of encoded data
-	switch {
-	case len(oldData) == 0:
-		// Read from named file
-		file, err := os.Open(oldName)
-		if err != nil {
-			println(err)
-			return oldName, nil, false, err
+	switch lower := strings.ToLower(*flagOutput); {
+	case lower == "" || lower == "[stdout]":
+		file := os.Stdout
+		if *flagBufferWrites {
+			b = bufio.NewWriterSize(file, *flagBufferSize) // ensure buffered writes
+			w = b
+		} else {
+			w = file
 		}
-		defer file.Close()
-		info, err := file.Stat()
+	case lower == "[stderr]":
+		file := os.Stderr
+		if *flagBufferWrites {
+			b = bufio.NewWriterSize(file, *flagBufferSize) // ensure buffered writes
+			w = b
+		} else {
+			w = file
+		}
+	case lower != "":
+		file, err := os.Create(*flagOutput)
 		if err != nil {
 			println(err)
-			return oldName, nil, false, err
-		}
-		oldSize = info.Size()
-		encoded = file
-	default:
-		// Use provided data (likely reading from an archive)
-		oldSize = int64(len(oldData))
-		encoded = bytes.NewReader(oldData)
-	}
-
-	// Select decompression algorithm based on file extension
-	decompressed := false
-	switch {
-	case ext == ".bz2":
-		decoder, err = bzip2.NewReader(encoded), nil
-		decompressed = true
-	case ext == ".gz":
-		decoder, err = gzip.NewReader(encoded)
-		decompressed = true
-	case ext == ".zst":
-		decoder, err = zstd.NewReader(encoded)
-		decompressed = true
-	default:
-		decoder, err = encoded, nil // "just reading" is minimal compression
-	}
-	if err != nil {
-		println(err) // error creating the decoder
-		return oldName, nil, false, err
-	}
-
-	// Decompress the data
-	if newData, err = ioutil.ReadAll(decoder); err != nil {
-		println(err) // error using the decoder
-		return oldName, nil, false, err
-	}
-	if decompressed {
-		// Decompress the name ("sample.go.zst" → "sample.go")
-		newName = strings.TrimSuffix(oldName, ext)
-		printf("  %8d → %8d bytes (%6.3f×)  decompress and scan %s",
-			oldSize, len(newData), float64(len(newData))/float64(oldSize), oldName)
-	} else {
-		newName = oldName
-		printf("  %8d bytes  scan %s", len(newData), oldName)
-	}
-
-	return newName, newData, false, nil
-}
-
-func (s *Scan) List(name string) {
-	file, err := os.Open(name)
-	if err != nil {
-		println(err)
-		return
-	}
-
-	println("scanning list of files:", name)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		s.File(scanner.Text())
-	}
-	file.Close()
-}
-
-var cap int
-
-func (s *Scan) File(name string) {
-	if !isVisible(name) {
-		return
-	}
-
-	info, err := os.Lstat(name)
-	if err != nil {
-		println(err)
-		return
-	}
-
-	// process plain files
-	if info.Mode().IsRegular() {
-		processRegularFile(name, s)
-	} else if info.Mode().IsDir() { // process directories
-		switch *flagRecursive {
-		case false:
-			// process files in this directory
-			println("processing Go files in directory", name)
-
-			bases, err := ioutil.ReadDir(name)
-			if err != nil {
-				println(err)
-				return
-			}
-
-			// user request: honor .gitignore blacklist
-			var skip map[string]bool
-
-			foundGitIgnore := false
-			for _, base := range bases {
-				if base.Name() == ".gitignore" {
-					foundGitIgnore = true
-					break
-				}
-			}
-			if foundGitIgnore {
-				gi, err := os.Open(".gitignore")
-				if err == nil {
-					skip = make(map[string]bool)
-					skip[".gitignore"] = true
-					scanner := bufio.NewScanner(gi)
-					for scanner.Scan() {
-						skip[scanner.Text()] = true
-					}
-					gi.Close()
-				}
-			}
-
-			for _, base := range bases {
-				if skip != nil && skip[base.Name()] {
-					printf("  skipping .gitignored file %q", base.Name())
-					continue
-				}
-				fullName := filepath.Join(name, base.Name())
-				if isVisible(fullName) && isGo(fullName) {
-					s.Scan(fullName, nil)
-				}
-			}
-		case true:
-			// process files in this directory hierarchy
-			println("processing Go files in and under directory", name)
-
-			walker := func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					println(err)
-					return err
-				}
-				name := info.Name()
-
-				// user request: honor .gitignore blacklist
-				var skip map[string]bool
-
-				gi, err := os.Open(".gitignore")
-				if err == nil {
-					skip = make(map[string]bool)
-					skip[".gitignore"] = true
-					scanner := bufio.NewScanner(gi)
-					for scanner.Scan() {
-						skip[scanner.Text()] = true
-					}
-					gi.Close()
-				}
-
-				if info.IsDir() {
-					if !isVisible(name) {
-						println("skipping hidden directory", name)
-						return filepath.SkipDir
-					}
-				} else {
-					if skip != nil && skip[name] {
-						printf("  skipping .gitignored file %q", name)
-					} else if isVisible(path) && isGo(path) {
-						s.Scan(path, nil)
-					}
-				}
-				return nil
-			}
-
-			err = filepath.Walk(name, walker) // standard library walker
-			// err = walk.Walk(name, walker) // mtj concurrent walker
-			// err = Walk(name, walker) // standard library walker
-			if err != nil {
-				println(err)
-			}
+			return nil, nil, err
 		}
+		w = file
+		flush = func() { file.Close() }
 	}
+	return w, flush, nil
 }
 
-type Work struct {
-	name   string
-	source []byte
-}
-
-type Summary struct {
-	bytes   int
-	tokens  int
-	matches int
-	lines   int
-	files   int
-}
-
-func (s *Summary) print(elapsed, user, system float64, printer func(string, ...interface{})) {
+func printSummary(s search.Summary, elapsed, user, system float64, printer func(string, ...interface{})) {
 	printer("performance\n")
-	if s.matches == 1 {
-		printer("  grep  %s match\n", formatInt(s.matches))
+	if s.Matches == 1 {
+		printer("  grep  %s match\n", formatInt(s.Matches))
 	} else {
-		printer("  grep  %s matches\n", formatInt(s.matches))
+		printer("  grep  %s matches\n", formatInt(s.Matches))
 	}
 	printer("  work  %s byte%s, %s token%s, %s line%s, %s file%s\n",
-		formatInt(s.bytes), plural(s.bytes, ""),
-		formatInt(s.tokens), plural(s.tokens, ""),
-		formatInt(s.lines), plural(s.lines, ""),
-		formatInt(s.files), plural(s.files, ""))
+		formatInt(s.Bytes), plural(s.Bytes, ""),
+		formatInt(s.Tokens), plural(s.Tokens, ""),
+		formatInt(s.Lines), plural(s.Lines, ""),
+		formatInt(s.Files), plural(s.Files, ""))
 	printer("  time  %.6f sec elapsed, %.6f sec user + %.6f system\n", elapsed, user, system)
 	if elapsed > 0 {
 		printer("  rate  %s bytes/sec, %s tokens/sec, %s lines/sec, %s files/sec\n",
-			formatInt(int(float64(s.bytes)/elapsed)),
-			formatInt(int(float64(s.tokens)/elapsed)),
-			formatInt(int(float64(s.lines)/elapsed)),
-			formatInt(int(float64(s.files)/elapsed)))
+			formatInt(int(float64(s.Bytes)/elapsed)),
+			formatInt(int(float64(s.Tokens)/elapsed)),
+			formatInt(int(float64(s.Lines)/elapsed)),
+			formatInt(int(float64(s.Files)/elapsed)))
 		printer("  cpus  %d worker%s (parallel speedup = %.2fx)\n",
 			*flagCPUs, plural(*flagCPUs, ""), (user+system)/elapsed)
 	}
@@ -478,399 +333,150 @@ func formatInt(n int) (s string) {
 	return s
 }
 
-var first = true
-var workers int
-var scattered int
-var work []chan Work
-var result []chan *Scan
-var done chan Summary
-
-func worker(wIn chan Work, sOut chan *Scan) {
-	for w := range wIn {
-		s := NewScan()
-		s.regex = regex.Copy()
-		s.scan(w.name, w.source)
-		sOut <- s
-	}
-	sOut <- &Scan{complete: true} // signal that this worker is done
-}
-
-func (s *Scan) Scan(name string, source []byte) {
-	if first {
-		workers = *flagCPUs
-		switch *flagUnordered {
-		case true:
-			const workQueue = 1024
-			work = make([]chan Work, 1)
-			result = make([]chan *Scan, 1)
-			work[0] = make(chan Work, workQueue)
-			result[0] = make(chan *Scan, workQueue)
-			for i := 0; i < workers; i++ {
-				go worker(work[0], result[0])
-			}
-		case false:
-			work = make([]chan Work, workers)
-			result = make([]chan *Scan, workers)
-			for i := 0; i < workers; i++ {
-				const balanceQueue = 512
-				work[i] = make(chan Work, balanceQueue)
-				result[i] = make(chan *Scan, balanceQueue)
-				go worker(work[i], result[i])
-			}
-		}
-		done = make(chan Summary)
-		go reporter() // wait for and gather results
-		first = false
-	}
-
-	switch {
-	case name == "": // end of scan
-		switch *flagUnordered {
-		case true:
-			close(work[0]) // signal completion to workers
-		case false:
-			for i := range work {
-				close(work[i]) // signal completion to workers
-			}
-		}
-	default: // another file to scan
-		switch *flagUnordered {
-		case true:
-			work[0] <- Work{name: name, source: source} // enqueue scan request
-		case false:
-			work[scattered%workers] <- Work{name: name, source: source} // enqueue scan request
-		}
-		scattered++
-	}
-}
-
-func formatMatch(b *bytes.Buffer, path, match []byte, line int) {
+func formatMatch(b *bytes.Buffer, path string, m search.Match) {
 	// expand buffer with single allocation
-	grow := (len(path) + 1) + (len(match) + 1)
-	n := ""
+	grow := (len(path) + 1) + (len(m.Text) + 1) + (len(m.Pattern) + 1)
+	n, c, o := "", "", ""
 	if *flagLineNumber {
-		n = strconv.Itoa(line)
+		n = strconv.Itoa(m.Line)
 		grow += len(n) + 1 // n + ':'
 	}
+	if *flagColumn {
+		c = strconv.Itoa(m.Column)
+		grow += len(c) + 1 // c + ':'
+	}
+	if *flagByteOffset {
+		o = strconv.Itoa(m.Offset)
+		grow += len(o) + 1 // o + ':'
+	}
 	b.Grow(grow)
 
-	// format is "path;match\n" or "path:line:match\n"
-	b.Write(path)
-	b.WriteByte(':')
+	// format is "path:match\n" or "path:line:column:offset:pattern:match\n"
+	paint(b, colorFile, path)
+	separate(b, ':')
 	if *flagLineNumber {
-		b.WriteString(n)
-		b.WriteByte(':')
+		paint(b, colorLine, n)
+		separate(b, ':')
+	}
+	if *flagColumn {
+		paint(b, colorLine, c)
+		separate(b, ':')
+	}
+	if *flagByteOffset {
+		paint(b, colorLine, o)
+		separate(b, ':')
+	}
+	if m.Pattern != "" {
+		// which of several patterns matched
+		paint(b, colorPattern, m.Pattern)
+		separate(b, ':')
+	}
+	if colorOutput && m.Start < m.End {
+		// highlight the matching text within the line
+		b.WriteString(m.Text[:m.Start])
+		paint(b, matchColor(m.Class), m.Text[m.Start:m.End])
+		b.WriteString(m.Text[m.End:])
+	} else {
+		b.WriteString(m.Text)
 	}
-	b.Write(match)
 	b.WriteByte('\n')
 }
 
-type Liner struct {
-	b []byte
-	t []byte
-}
-
-func newLiner(b []byte) *Liner {
-	return &Liner{b: b}
-}
-
-func (liner *Liner) scan() bool {
-	if len(liner.b) == 0 {
-		return false
+// formatFile formats the "-c", "-l", and "-L" report for a file with count
+// matching lines: "path:count" or "path", if the file is to be named at all
+func formatFile(b *bytes.Buffer, path string, count int) {
+	switch {
+	case *flagFilesWith && count == 0:
+		return
+	case *flagFilesWithout && count > 0:
+		return
+	case *flagJSON:
+		file, member := search.SplitName(path)
+		encodeJSON(b, jsonFile{Type: "file", File: file, Member: member, Count: count})
+		return
 	}
-	index := bytes.IndexByte(liner.b, '\n')
-	if index < 0 {
-		liner.t, liner.b = liner.b, nil
-	} else {
-		liner.t, liner.b = liner.b[:index+1], liner.b[index+1:]
+	paint(b, colorFile, path)
+	if *flagCount && !*flagFilesWith && !*flagFilesWithout {
+		separate(b, ':')
+		b.WriteString(strconv.Itoa(count))
 	}
-	return true
-}
-
-func (liner *Liner) text() []byte {
-	return liner.t
+	b.WriteByte('\n')
 }
 
-func (liner *Liner) trim() []byte {
-	n := len(liner.t)
-	if n > 0 && liner.t[n-1] == '\n' {
-		return liner.t[:n-1]
+// formatGroup formats a match with its context lines, after a "--" line when
+// lines have been printed and the last, lastLine, is not adjacent. It returns
+// the number of the last line it formats.
+func formatGroup(b *bytes.Buffer, path string, m search.Match, printed bool, lastLine int) int {
+	first := m.Line
+	if len(m.Before) > 0 {
+		first = m.Before[0].Line
 	}
-	return liner.t
-}
-
-func tokenHandler(flag bool, lexer *lex.Lexer, text []byte, s *Scan, printLine int, buf *bytes.Buffer) int {
-	if flag { //&& printLine < lexer.Line {
-		if lexer.Type == lex.String && lexer.Subtype == lex.Raw && bytes.Count(text, []byte{'\n'}) > 0 {
-			// match each line of the raw string individually
-			lineInString := 0
-			liner := newLiner(text)
-			for liner.scan() {
-				if s.regex.Match(liner.text()) {
-					s.matches++
-					line := lexer.Line + lineInString
-					if printLine < line {
-						formatMatch(buf, s.path, liner.trim(), line)
-						printLine = line
-					}
-				}
-				lineInString++
-			}
-		} else if lexer.Type == lex.Comment && lexer.Subtype == lex.Block && bytes.Count(text, []byte{'\n'}) > 0 {
-			// match each line of the block comment individually
-			lineInString := 0
-			liner := newLiner(text)
-			for liner.scan() {
-				if s.regex.Match(liner.text()) {
-					s.matches++
-					line := lexer.Line + lineInString
-					if printLine < line {
-						formatMatch(buf, s.path, liner.trim(), line)
-						printLine = line
-					}
-				}
-				lineInString++
-			}
-		} else if printLine < lexer.Line && s.regex.Match(text) {
-			// match the token but print the line that contains it
-			s.matches++
-			formatMatch(buf, s.path, lexer.GetLine(), lexer.Line)
-			printLine = lexer.Line
-		}
+	if printed && first != lastLine+1 {
+		paint(b, colorSep, "--")
+		b.WriteByte('\n')
 	}
-	return printLine
-}
-
-func (s *Scan) scan(name string, source []byte) {
-	var err error
-	var newName string
-	var mapped bool
-	newName, source, mapped, err = decompress(name, source)
-	if err != nil {
-		return
+	for _, l := range m.Before {
+		formatContext(b, path, l)
 	}
-
-	if !*flagGo && isBinary(source) {
-		// enable printf if desired. makes log cluttered:
-		// printf("skipping binary file %s", newName)
-		if *flagMap && mapped {
-			// finished using []byte] source so unmap file to free the file descriptor
-			gommap.MMap(source).UnsafeUnmap()
-		}
-		return
+	formatMatch(b, path, m)
+	for _, l := range m.After {
+		formatContext(b, path, l)
 	}
-
-	s.path = []byte(newName)
-	s.bytes = len(source)
-	s.lines = bytes.Count(source, []byte{'\n'})
-	s.files = 1
-
-	printLine := 0
-
-	// handle grep mode
-	if *flagActLikeGrep || G {
-		fileLine := 0
-		liner := newLiner(source)
-		buf := new(bytes.Buffer)
-		for liner.scan() {
-			fileLine++
-			if s.regex.Match(liner.text()) {
-				s.matches++
-				formatMatch(buf, s.path, liner.trim(), fileLine)
-			}
-		}
-		s.report = buf.Bytes()
-		if *flagMap && mapped {
-			// finished using []byte] source so unmap file to free the file descriptor
-			gommap.MMap(source).UnsafeUnmap()
-		}
-		return
-	}
-
-	// Perform the scan by tabulating token types, subtypes, and values
-	// lexer := &lex.Lexer{Input: source, Mode: lex.ScanGo} // | lex.SkipSpace}
-	lexer := lex.NewLexer(source, lex.ScanGo)
-	expectPackageName := false
-	buf := new(bytes.Buffer)
-	for tok, text := lexer.Scan(); tok != lex.EOF; tok, text = lexer.Scan() {
-		s.tokens++
-
-		// go mini-parser: expect package name after "package" keyword
-		if expectPackageName && tok == lex.Identifier {
-			if P && s.regex.Match(text) {
-				s.matches++
-				if printLine < lexer.Line {
-					formatMatch(buf, s.path, text, lexer.Line)
-					printLine = lexer.Line
-				}
-			}
-			expectPackageName = false
-		} else if tok == lex.Keyword && bytes.Equal(text, []byte("package")) {
-			expectPackageName = true // set expectations
-		}
-
-		if tok < 0 {
-			if f := dispatch[-tok]; f != nil && *f {
-				// printLine = tokenHandler(*f, lexer, text, s, printLine, buf)
-				if lexer.Type == lex.String && lexer.Subtype == lex.Raw && bytes.Count(text, []byte{'\n'}) > 0 {
-					// match each line of the raw string individually
-					lineInString := 0
-					liner := newLiner(text)
-					for liner.scan() {
-						if s.regex.Match(liner.text()) {
-							s.matches++
-							line := lexer.Line + lineInString
-							if printLine < line {
-								formatMatch(buf, s.path, liner.trim(), line)
-								printLine = line
-							}
-						}
-						lineInString++
-					}
-				} else if lexer.Type == lex.Comment && lexer.Subtype == lex.Block && bytes.Count(text, []byte{'\n'}) > 0 {
-					// match each line of the block comment individually
-					lineInString := 0
-					liner := newLiner(text)
-					for liner.scan() {
-						if s.regex.Match(liner.text()) {
-							s.matches++
-							line := lexer.Line + lineInString
-							if printLine < line {
-								formatMatch(buf, s.path, liner.trim(), line)
-								printLine = line
-							}
-						}
-						lineInString++
-					}
-				} else if printLine < lexer.Line && s.regex.Match(text) {
-					// match the token but print the line that contains it
-					s.matches++
-					formatMatch(buf, s.path, lexer.GetLine(), lexer.Line)
-					printLine = lexer.Line
-				}
-			}
-			if tok == lex.Number && V && printLine < lexer.Line {
-				n := text
-				var nS int
-				if n[0] == '-' { // never used, but someday...
-					nS = -1
-					n = n[1:]
-				}
-				switch vIsInt {
-				case true:
-					var nI uint64
-					nI, err = strconv.ParseUint(string(n), 0, 64)
-					if err == nil && nS == sign && nI == vInt {
-						// match the token but print the line
-						formatMatch(buf, s.path, lexer.GetLine(), lexer.Line)
-						printLine = lexer.Line
-					}
-				case false:
-					var nF float64
-					nF, err = strconv.ParseFloat(string(n), 64)
-					if err == nil && nS == sign && nF == vFloat {
-						// match the token but print the line
-						formatMatch(buf, s.path, lexer.GetLine(), lexer.Line)
-						printLine = lexer.Line
-					}
-				}
-			}
-		}
-
-	}
-	s.report = buf.Bytes()
-	if *flagMap && mapped {
-		// finished using []byte] source so unmap file to free the file descriptor
-		gommap.MMap(source).UnsafeUnmap()
+	if len(m.After) > 0 {
+		return m.After[len(m.After)-1].Line
 	}
+	return m.Line
 }
 
-// Complete a scan
-func (s *Scan) Complete() Summary {
-	if !s.complete {
-		s.Scan("", nil)  // Signal end of additional files...
-		s.total = <-done // ...and await completion.of scanning & reporting
-		for i := range result {
-			close(result[i])
-		}
-		s.complete = true // Record completion
+// formatContext formats a context line as grep does: "path-line-text"
+func formatContext(b *bytes.Buffer, path string, l search.Line) {
+	paint(b, colorFile, path)
+	separate(b, '-')
+	if *flagLineNumber {
+		paint(b, colorLine, strconv.Itoa(l.Line))
+		separate(b, '-')
 	}
-	return s.total
+	b.WriteString(l.Text)
+	b.WriteByte('\n')
 }
 
-func reporter() {
-	var w io.Writer
-	var b *bufio.Writer
-
-	switch lower := strings.ToLower(*flagOutput); {
-	case lower == "" || lower == "[stdout]":
-		file := os.Stdout
-		if *flagBufferWrites {
-			b = bufio.NewWriterSize(file, *flagBufferSize) // ensure buffered writes
-			w = b
-		} else {
-			w = file
-		}
-	case lower == "[stderr]":
-		file := os.Stderr
-		if *flagBufferWrites {
-			b = bufio.NewWriterSize(file, *flagBufferSize) // ensure buffered writes
-			w = b
-		} else {
-			w = file
-		}
-	case lower != "":
-		var err error
-		file, err := os.Create(*flagOutput)
-		if err != nil {
-			println(err)
-			return
-		}
-		defer file.Close()
-		w = file
-	}
+// jsonMatch is the "-json" output record for a match
+type jsonMatch struct {
+	Type   string `json:"type"` // "match"
+	File   string `json:"file"`
+	Member string `json:"member,omitempty"` // name within archive file
+	search.Match
+}
 
-	// summary statistics
-	total := Summary{}
+// jsonFile is the "-json" output record for a file under "-c", "-l", or "-L"
+type jsonFile struct {
+	Type   string `json:"type"` // "file"
+	File   string `json:"file"`
+	Member string `json:"member,omitempty"` // name within archive file
+	Count  int    `json:"count"`
+}
 
-	// report results per file
-	gathered := 0
-	completed := 0
-	for {
-		// get next result in search order
-		var s *Scan
-		switch *flagUnordered {
-		case false:
-			s = <-result[gathered%workers]
-		case true:
-			s = <-result[0]
-		}
-		gathered++
+// jsonSummary is the final "-json" output record
+type jsonSummary struct {
+	Type string `json:"type"` // "summary"
+	search.Summary
+}
 
-		// handle completion events
-		if s.complete {
-			completed++ // one more worker has finished
-			if completed == workers {
-				break // all workers have now finished
-			}
-			continue
-		}
+func formatJSON(b *bytes.Buffer, path string, match search.Match) {
+	file, member := search.SplitName(path)
+	encodeJSON(b, jsonMatch{Type: "match", File: file, Member: member, Match: match})
+}
 
-		// report all matching lines in file
-		w.Write(s.report)
+func formatJSONSummary(b *bytes.Buffer, summary search.Summary) {
+	encodeJSON(b, jsonSummary{Type: "summary", Summary: summary})
+}
 
-		total.bytes += s.bytes
-		total.tokens += s.tokens
-		total.matches += s.matches
-		total.lines += s.lines
-		total.files++
-	}
-	if b != nil {
-		b.Flush() // bug fix: must defer flush until return
+func encodeJSON(b *bytes.Buffer, v interface{}) {
+	e := json.NewEncoder(b) // one object per line
+	e.SetEscapeHTML(false)  // keep "<-" and "&&" readable
+	if err := e.Encode(v); err != nil {
+		println(err)
 	}
-
-	// signal completion to main program
-	done <- total // scanning complete, here are totals
 }
 
 func println(v ...interface{}) {
@@ -892,239 +498,6 @@ func plural(n int, fill string) string {
 	return "s"
 }
 
-type searchMode struct {
-	// c: search Comments ("//..." or "/*...*/")
-	C bool
-	// d: search Defined non-types (iota, nil, new, true,...)
-	D bool
-	// grep mode ?
-	G bool
-	// i: search Identifiers ([a-zA-Z][a-zA-Z0-9]*)
-	I bool
-	// k: search Keywords (if, for, func, go, ...)
-	K bool
-	// n: search Numbers as strings (255 as 255, 0.255, 1e255)
-	N bool
-	// o: search Operators (,+-*/[]{}()>>...)
-	O bool
-	// p: search Package names
-	P bool
-	// r: search Rune literals ('a', '\U00101234')
-	R bool
-	// s: search Strings ("quoted" or `raw`)
-	S bool
-	// t: search Types (bool, int, float64, map, ...)
-	T bool
-	// v: search numeric Values (255 as 0b1111_1111, 0377, 255, 0xff)
-	V      bool
-	vIsInt bool
-	vInt   uint64
-	vFloat float64
-}
-
-func parseFirstArg(input string) searchMode {
-	result := searchMode{}
-	// a: search all of the following
-	if strings.Contains(input, "a") {
-		result.C = true
-		result.D = true
-		result.I = true
-		result.K = true
-		result.N = true
-		result.O = true
-		result.P = true
-		result.R = true
-		result.S = true
-		result.T = true
-		result.V = true
-	}
-
-	// initialize token class inclusion flags
-	for _, class := range input {
-		switch class {
-		case 'a':
-			// already noted
-		case 'c':
-			result.C = true
-		case 'C':
-			result.C = false
-		case 'd':
-			result.D = true
-		case 'D':
-			result.D = false
-		case 'g':
-			result.G = true
-		case 'i':
-			result.I = true
-		case 'I':
-			result.I = false
-		case 'k':
-			result.K = true
-		case 'K':
-			result.K = false
-		case 'n':
-			result.N = true
-		case 'N':
-			result.N = false
-		case 'o':
-			result.O = true
-		case 'O':
-			result.O = false
-		case 'p':
-			result.P = true
-		case 'P':
-			result.P = false
-		case 'r':
-			result.R = true
-		case 'R':
-			result.R = false
-		case 's':
-			result.S = true
-		case 'S':
-			result.S = false
-		case 't':
-			result.T = true
-		case 'T':
-			result.T = false
-		case 'v':
-			result.V = true
-		case 'V':
-			result.V = false
-		default:
-			fmt.Fprintf(os.Stderr, "error: unrecognized token class '%c'\n", class)
-		}
-	}
-	return result
-}
-
-func setupModeGG(args []string) searchMode {
-	res := searchMode{}
-	if !*flagActLikeGrep {
-		if len(args) < 2 {
-			// not enough args received, complete args with empty strings
-			for i := len(args); i < 2; i++ {
-				args = append(args, "")
-			}
-		}
-		// handle "all" flag first before subsequent upper-case anti-flags
-		res = parseFirstArg(args[0])
-
-		// initialize numeric value matcher
-		if res.V && len(args[1]) > 0 {
-			n := args[1]
-			if n[0] == '-' {
-				sign = -1
-				n = n[1:]
-			}
-			var err error
-			res.vInt, err = strconv.ParseUint(n, 0, 64)
-			res.vIsInt = true
-			if err != nil {
-				res.vIsInt = false
-				// we did not consume all the input...maybe it is a float.
-				res.vFloat, err = strconv.ParseFloat(n, 64)
-				// _ = res.vFloat + -5.25
-				if err != nil {
-					res.V = false
-					fmt.Fprintf(os.Stderr, "error: %v\n", err)
-				}
-			}
-		}
-	}
-	return res
-}
-
-func getRegexp(input string) (*regexp.Regexp, error) {
-	regexp, err := regexp.Compile(input)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-	}
-	return regexp, err
-}
-
-// Scanner is an interace created to allow us to create some tests
-type Scanner interface {
-	Scan(name string, source []byte)
-}
-
-type ReadNexter interface {
-	Read(p []byte) (n int, err error)
-	Next() (string, error)
-}
-
-func processRegularFile(name string, s Scanner) {
-	var err error
-	var data []byte
-	if isArchive(name) && isCompressed(name) {
-		name, data, _, err = decompress(name, nil)
-		if err != nil {
-			println(err)
-			return
-		}
-	}
-
-	var archive io.Reader
-	switch {
-	case len(data) == 0:
-		f, err := os.Open(name)
-		if err != nil {
-			println(err)
-			return
-		}
-		defer f.Close()
-		archive = f
-	default:
-		archive = bytes.NewReader(data)
-	}
-
-	ext := strings.ToLower(filepath.Ext(name))
-	switch {
-	case ext == ".cpio":
-		println("processing cpio archive", name)
-		r := newMultiReader(archive, ext, "")
-		scanFile(name, r, s)
-	case ext == ".tar":
-		println("processing tar archive", name)
-		r := newMultiReader(archive, ext, "")
-		scanFile(name, r, s)
-	case ext == ".zip":
-		println("processing zip archive:", name)
-		mr := newMultiReader(nil, ext, name)
-		scanFile(name, mr, s)
-	case isGo(name):
-		s.Scan(name, nil)
-	default:
-		println("skipping file with unrecognized extension:", name)
-	}
-}
-
-func scanFile(fileName string, r ReadNexter, s Scanner) {
-	for {
-		name, err := r.Next()
-		if err == io.EOF {
-			break // End of archive
-		}
-		if err != nil {
-			println(err)
-			return
-		}
-
-		memberName := fileName + "::" + name // "archive.cpio::file.go"
-		if !isGo(name) {
-			println("skipping file with unrecognized extension:", memberName)
-			continue
-		}
-		var buf bytes.Buffer
-		buf.ReadFrom(r)
-		bytes := buf.Bytes()
-		if err != nil {
-			println(err)
-			return
-		}
-		s.Scan(memberName, bytes)
-	}
-}
-
 func getResourceUsage() (user, system float64, size uint64) {
 	var usage syscall.Rusage
 	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
@@ -0,0 +1,171 @@
+package search
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// astKinds are the kinds of syntax nodes searched in AST mode, each with the
+// name that is matched: function names; methods as "Type.Method"; callees as
+// written, "fmt.Println"; type names; struct field names; interface method
+// names; and labels.
+var astKinds = []string{"func", "method", "call", "type", "field", "interface", "label"}
+
+// parseKinds reads a comma-separated list of the known kinds, or "all"
+func parseKinds(input, what string, known []string) (map[string]bool, error) {
+	if input == "" {
+		return nil, nil
+	}
+	kinds := map[string]bool{}
+	for _, k := range strings.Split(input, ",") {
+		k = strings.TrimSpace(k)
+		switch {
+		case k == "all":
+			for _, k := range known {
+				kinds[k] = true
+			}
+		case contains(known, k):
+			kinds[k] = true
+		default:
+			return nil, errors.New("unknown " + what + ": " + k + " (want " + strings.Join(known, ", ") + ", or all)")
+		}
+	}
+	return kinds, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// astName is a named syntax node found by go/parser
+type astName struct {
+	kind       string
+	name       string // as matched: "Type.Method" for methods
+	line       int
+	start, end int // offsets of the node's name in the source
+}
+
+// astNames returns the names of the nodes of the given kinds in a source
+// file in the order they appear, or ok false if the file does not parse
+func astNames(name string, source []byte, kinds map[string]bool) (names []astName, ok bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+	offset := func(p token.Pos) int { return fset.Position(p).Offset }
+	add := func(kind, name string, node ast.Node) {
+		if kinds[kind] {
+			p := fset.PositionFor(node.Pos(), false)
+			names = append(names, astName{kind: kind, name: name, line: p.Line, start: p.Offset, end: offset(node.End())})
+		}
+	}
+	text := func(node ast.Node) string {
+		return string(source[offset(node.Pos()):offset(node.End())])
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Recv == nil || len(n.Recv.List) == 0 {
+				add("func", n.Name.Name, n.Name)
+			} else {
+				add("method", receiverType(n.Recv.List[0].Type)+"."+n.Name.Name, n.Name)
+			}
+		case *ast.CallExpr:
+			add("call", text(n.Fun), n.Fun)
+		case *ast.TypeSpec:
+			add("type", n.Name.Name, n.Name)
+		case *ast.StructType:
+			for _, f := range n.Fields.List {
+				for _, id := range f.Names {
+					add("field", id.Name, id)
+				}
+				if len(f.Names) == 0 {
+					add("field", text(f.Type), f.Type) // embedded
+				}
+			}
+		case *ast.InterfaceType:
+			for _, f := range n.Methods.List {
+				for _, id := range f.Names {
+					add("interface", id.Name, id)
+				}
+			}
+		case *ast.LabeledStmt:
+			add("label", n.Label.Name, n.Label)
+		}
+		return true
+	})
+	sort.SliceStable(names, func(i, j int) bool { return names[i].start < names[j].start })
+	return names, true
+}
+
+// receiverType returns the name of a method's receiver type, without
+// pointer or type parameters: "Searcher" for "(s *Searcher)"
+func receiverType(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.IndexListExpr:
+			x = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return "?"
+		}
+	}
+}
+
+// scanAST searches the named syntax nodes of a file, reporting whether it
+// parsed. Files that do not parse are searched by token instead.
+func (s *Searcher) scanAST(matchers []*matcher, name string, source []byte, r *Result) bool {
+	names, ok := astNames(name, source, s.ast)
+	if !ok {
+		return false
+	}
+	f := &fileScan{fold: s.opt.IgnoreCase, source: source, r: r, invert: s.opt.Invert}
+	for _, n := range names {
+		if s.enough(r) {
+			break
+		}
+		line := n.line
+		for _, m := range matchers {
+			f.m = m
+			loc := m.regex.FindStringIndex(n.name)
+			if f.invert {
+				f.note(line, n.start, n.kind, []byte(n.name), loc != nil)
+				continue
+			}
+			if loc == nil {
+				continue
+			}
+			r.Summary.Matches++
+			if f.printLine < line {
+				span := []int{n.start, n.end}
+				if n.end-n.start == len(n.name) {
+					span = []int{n.start + loc[0], n.start + loc[1]} // the name as written
+				}
+				f.add(line, n.start, span, n.kind, []byte(n.name), f.lineAt(n.start))
+			}
+			break
+		}
+	}
+	if f.invert && !s.enough(r) {
+		f.flush()
+	}
+	return true
+}
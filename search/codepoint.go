@@ -0,0 +1,140 @@
+package search
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// codePointTerm is one condition on the code point of a rune literal: in
+// the range lo through hi, or, when table is set, in a Unicode class
+type codePointTerm struct {
+	lo, hi rune
+	table  *unicode.RangeTable
+	not    bool // "\P{Greek}" is the complement of "\p{Greek}"
+}
+
+func (t codePointTerm) match(r rune) bool {
+	if t.table != nil {
+		return unicode.Is(t.table, r) != t.not
+	}
+	return t.lo <= r && r <= t.hi
+}
+
+// codePointQuery matches rune literals satisfying any of its terms
+type codePointQuery []codePointTerm
+
+func (q codePointQuery) match(r rune) bool {
+	for _, t := range q {
+		if t.match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCodePointQuery reads a rune value search: a code point, written as
+// a character, "A"; as a rune literal, "'\x41'"; or in Unicode notation,
+// "U+0041"; an inclusive range of code points, "a..z"; a Unicode class in
+// the notation of regular expressions, "\p{Cyrillic}", "\pL", or "\P{L}";
+// or a set of these in braces, "{A..F,a..f}".
+func parseCodePointQuery(input string) (codePointQuery, error) {
+	if strings.HasPrefix(input, "{") && strings.HasSuffix(input, "}") && len(input) > 2 {
+		q := codePointQuery{}
+		for _, s := range strings.Split(input[1:len(input)-1], ",") {
+			t, err := parseCodePointTerm(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			q = append(q, t)
+		}
+		return q, nil
+	}
+	t, err := parseCodePointTerm(input)
+	if err != nil {
+		return nil, err
+	}
+	return codePointQuery{t}, nil
+}
+
+func parseCodePointTerm(input string) (codePointTerm, error) {
+	t := codePointTerm{}
+	if strings.HasPrefix(input, `\p`) || strings.HasPrefix(input, `\P`) {
+		t.not = input[1] == 'P'
+		name := input[2:]
+		if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+			name = name[1 : len(name)-1]
+		} else if utf8.RuneCountInString(name) != 1 {
+			return t, errors.New("invalid Unicode class: " + input) // "\pL" is one letter
+		}
+		if t.table = unicodeTable(name); t.table == nil {
+			return t, errors.New("unknown Unicode class: " + input)
+		}
+		return t, nil
+	}
+
+	// a range, "a..z", with a bound on each side: "." is a character
+	if i := strings.Index(input, ".."); i > 0 && i+2 < len(input) {
+		var err error
+		if t.lo, err = parseCodePoint(input[:i]); err != nil {
+			return t, err
+		}
+		if t.hi, err = parseCodePoint(input[i+2:]); err != nil {
+			return t, err
+		}
+		if t.lo > t.hi {
+			return t, errors.New("empty range: " + input)
+		}
+		return t, nil
+	}
+	r, err := parseCodePoint(input)
+	t.lo, t.hi = r, r
+	return t, err
+}
+
+// parseCodePoint reads a character, a rune literal, or "U+" and hex digits
+func parseCodePoint(s string) (rune, error) {
+	switch {
+	case utf8.RuneCountInString(s) == 1:
+		r, _ := utf8.DecodeRuneInString(s)
+		if r != utf8.RuneError || s == string(utf8.RuneError) {
+			return r, nil
+		}
+	case len(s) > 2 && (s[:2] == "U+" || s[:2] == "u+"):
+		u, err := strconv.ParseUint(s[2:], 16, 32)
+		if err == nil && u <= unicode.MaxRune {
+			return rune(u), nil
+		}
+	case strings.HasPrefix(s, "'"):
+		if r, ok := unquoteRune([]byte(s)); ok {
+			return r, nil
+		}
+	}
+	return 0, errors.New("invalid code point: " + s)
+}
+
+// unquoteRune returns the code point of a rune literal, "'A'" or "'\x41'"
+func unquoteRune(text []byte) (rune, bool) {
+	if len(text) < 3 || text[0] != '\'' || text[len(text)-1] != '\'' {
+		return 0, false
+	}
+	r, _, tail, err := strconv.UnquoteChar(string(text[1:len(text)-1]), '\'')
+	return r, err == nil && tail == ""
+}
+
+// unicodeTable returns the Unicode category, script, or property of the
+// given name, as regular expressions name them, or nil if there is none
+func unicodeTable(name string) *unicode.RangeTable {
+	if t, ok := unicode.Categories[name]; ok {
+		return t
+	}
+	if t, ok := unicode.Scripts[name]; ok {
+		return t
+	}
+	if t, ok := unicode.Properties[name]; ok {
+		return t
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"testing"
+)
+
+func Test_codePointQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+
+		match   []string
+		noMatch []string
+	}{
+		{
+			name:    "character",
+			query:   "A",
+			match:   []string{`'A'`, `'\x41'`, `'\101'`, `'\u0041'`, `'\U00000041'`},
+			noMatch: []string{`'a'`, `'B'`},
+		},
+
+		{
+			name:    "rune literal",
+			query:   `'\n'`,
+			match:   []string{`'\n'`, `'\x0a'`, `'\012'`},
+			noMatch: []string{`'n'`},
+		},
+
+		{
+			name:    "unicode notation",
+			query:   "U+00E9",
+			match:   []string{`'é'`, `'\u00e9'`, `'\xe9'`},
+			noMatch: []string{`'e'`},
+		},
+
+		{
+			name:    "range",
+			query:   "a..f",
+			match:   []string{`'a'`, `'c'`, `'\x66'`},
+			noMatch: []string{`'g'`, `'A'`},
+		},
+
+		{
+			name:    "dot",
+			query:   ".",
+			match:   []string{`'.'`},
+			noMatch: []string{`'a'`},
+		},
+
+		{
+			name:    "script",
+			query:   `\p{Cyrillic}`,
+			match:   []string{`'Ж'`, `'\u0416'`},
+			noMatch: []string{`'Z'`},
+		},
+
+		{
+			name:    "category",
+			query:   `\pN`,
+			match:   []string{`'7'`, `'٣'`},
+			noMatch: []string{`'x'`},
+		},
+
+		{
+			name:    "negated class",
+			query:   `\P{L}`,
+			match:   []string{`'7'`, `' '`},
+			noMatch: []string{`'x'`, `'Ж'`},
+		},
+
+		{
+			name:    "set",
+			query:   `{A..F, a..f, \p{Greek}}`,
+			match:   []string{`'B'`, `'e'`, `'λ'`},
+			noMatch: []string{`'G'`, `'z'`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseCodePointQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseCodePointQuery(%q) error = %v", tt.query, err)
+			}
+			for _, s := range tt.match {
+				if r, ok := unquoteRune([]byte(s)); !ok || !q.match(r) {
+					t.Errorf("%q does not match %s, want match", tt.query, s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if r, ok := unquoteRune([]byte(s)); !ok || q.match(r) {
+					t.Errorf("%q matches %s, want no match", tt.query, s)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseCodePointQueryErrors(t *testing.T) {
+	for _, query := range []string{"", "ab", "U+", "U+110000", "U+xyz", `\p{Klingon}`, `\pLu`, "z..a", `'\q'`, `'ab'`, "{A,}"} {
+		if _, err := parseCodePointQuery(query); err == nil {
+			t.Errorf("parseCodePointQuery(%q) error = nil, want error", query)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package search
+
+import (
+	"bytes"
+)
+
+// declarations documented by the comment group before them
+var declKeywords = [][]byte{[]byte("package"), []byte("func"), []byte("type"), []byte("var"), []byte("const")}
+
+// commentGroup looks ahead from offset, the end of a comment that begins
+// its line or follows another such comment, past the rest of its comment
+// group: comments separated by no more than a newline. It returns the offset
+// where the group ends and whether the group documents the declaration that
+// follows it, as go/parser would record it as the declaration's Doc.
+func commentGroup(source []byte, offset int) (end int, doc bool) {
+	i := offset
+	for newlines := 0; i < len(source); {
+		switch c := source[i]; {
+		case c == '\n':
+			if newlines++; newlines > 1 {
+				return i, false // a blank line ends the group
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case bytes.HasPrefix(source[i:], []byte("//")):
+			if j := bytes.IndexByte(source[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(source)
+			}
+			newlines = 0
+		case bytes.HasPrefix(source[i:], []byte("/*")):
+			j := bytes.Index(source[i+2:], []byte("*/"))
+			if j < 0 {
+				return len(source), false
+			}
+			i += 2 + j + 2
+			newlines = 0
+		default:
+			return i, newlines == 1 && isDeclKeyword(source[i:])
+		}
+	}
+	return i, false
+}
+
+// isDeclKeyword reports whether s begins with a keyword that begins a
+// documented declaration
+func isDeclKeyword(s []byte) bool {
+	for _, k := range declKeywords {
+		if bytes.HasPrefix(s, k) && (len(s) == len(k) || !isIdentByte(s[len(k)])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c >= 0x80
+}
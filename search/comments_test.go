@@ -0,0 +1,36 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_commentGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string // "|" marks the end of the comment looked ahead from
+		doc    bool
+	}{
+		{name: "separate", source: "// F does|\n\nfunc F()", doc: false},
+		{name: "adjacent func", source: "// F does|\nfunc F()", doc: true},
+		{name: "group", source: "// F does|\n// more\n/* and more */\ntype F int", doc: true},
+		{name: "blank line in group", source: "// F does|\n\n// more\nvar F int", doc: false},
+		{name: "package", source: "// Package p|\npackage p", doc: true},
+		{name: "const", source: "/* c */|\r\nconst c = 1", doc: true},
+		{name: "indented", source: "\t// x is|\n\tvar x int", doc: true},
+		{name: "statement", source: "// x is|\nx := 1", doc: false},
+		{name: "identifier", source: "// funcs|\nfuncs()", doc: false},
+		{name: "same line", source: "/* c */| const c = 1", doc: false},
+		{name: "end of file", source: "// end|", doc: false},
+		{name: "unterminated", source: "// x|\n/* y", doc: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := strings.IndexByte(tt.source, '|')
+			source := []byte(tt.source[:i] + tt.source[i+1:])
+			if _, doc := commentGroup(source, i); doc != tt.doc {
+				t.Errorf("commentGroup(%q) doc = %v, want %v", tt.source, doc, tt.doc)
+			}
+		})
+	}
+}
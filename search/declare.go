@@ -0,0 +1,68 @@
+package search
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// declarations returns the offsets of the identifiers in a source file that
+// declare names rather than use them: those of functions, methods, types,
+// type parameters, variables and constants, import aliases, parameters and
+// results, struct fields and interface methods, labels, and the left of ":="
+// as in "x, err := f()" and "for k, v := range m". It is syntax only, so a
+// name redeclared by ":=" counts as declared there. A file that does not
+// parse declares nothing.
+func declarations(name string, source []byte) map[int]bool {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, source, parser.SkipObjectResolution)
+	if err != nil {
+		return map[int]bool{}
+	}
+	decls := map[int]bool{}
+	add := func(x ast.Expr) {
+		if id, ok := x.(*ast.Ident); ok {
+			decls[fset.Position(id.Pos()).Offset] = true
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			add(n.Name)
+		case *ast.Field: // receivers, parameters, results, fields, methods
+			for _, id := range n.Names {
+				add(id)
+			}
+		case *ast.ValueSpec:
+			for _, id := range n.Names {
+				add(id)
+			}
+		case *ast.TypeSpec:
+			add(n.Name)
+		case *ast.ImportSpec:
+			if n.Name != nil {
+				add(n.Name)
+			}
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, x := range n.Lhs {
+					add(x)
+				}
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				if n.Key != nil {
+					add(n.Key)
+				}
+				if n.Value != nil {
+					add(n.Value)
+				}
+			}
+		case *ast.LabeledStmt:
+			add(n.Label)
+		}
+		return true
+	})
+	return decls
+}
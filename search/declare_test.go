@@ -0,0 +1,39 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_declarations(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string // "@" marks each declaring identifier
+	}{
+		{name: "func", source: "package p\nfunc @F(@a, @b int) (@n int) { return a + b }"},
+		{name: "method", source: "package p\nfunc (@t *T) @M() { t.M() }"},
+		{name: "type", source: "package p\ntype @List[@E any] struct{ @items []E; @next *List[E] }"},
+		{name: "interface", source: "package p\ntype @I interface{ @M(@x int); fmt.Stringer }"},
+		{name: "var and const", source: "package p\nvar @x, @y = f()\nconst (\n\t@c = iota\n\t@d\n)"},
+		{name: "define", source: "package p\nfunc @f() { @x, @err := g(); x, err = g(); _ = x }"},
+		{name: "range", source: "package p\nfunc @f(@m M) { for @k, @v := range m { use(k, v) }; for k = range m {} }"},
+		{name: "label", source: "package p\nfunc @f() {\n@outer:\n\tfor { break outer }\n}"},
+		{name: "import alias", source: "package p\nimport @str \"strings\"\nvar @s = str.ToUpper"},
+		{name: "does not parse", source: "package p\nfunc F( {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := map[int]bool{}
+			parts := strings.Split(tt.source, "@")
+			source := parts[0]
+			for _, part := range parts[1:] {
+				want[len(source)] = true
+				source += part
+			}
+			if got := declarations("p.go", []byte(source)); !reflect.DeepEqual(got, want) {
+				t.Errorf("declarations(%q) = %v, want %v", tt.source, got, want)
+			}
+		})
+	}
+}
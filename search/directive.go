@@ -0,0 +1,95 @@
+package search
+
+import (
+	"bytes"
+	"strings"
+)
+
+// splitDirectiveQuery separates a directive search, "go:linkname runtime\.",
+// into patterns for the directive's name and for its arguments
+func splitDirectiveQuery(input string) (name, args string) {
+	input = strings.TrimSpace(input)
+	if i := strings.IndexAny(input, " \t"); i >= 0 {
+		return input[:i], strings.TrimSpace(input[i+1:])
+	}
+	return input, ""
+}
+
+// parseDirective returns the name of the directive in a line of a comment
+// and the offsets in the line of the name and of its arguments. ok is false
+// when the line is prose. Directives are those of tools in the form
+// "//tool:name", as "//go:generate" and "//lint:ignore"; cgo's "//export"
+// and "//extern"; "//line" and "//nolint"; build constraints in the older
+// form "// +build"; and "#cgo" lines in cgo preambles.
+func parseDirective(line []byte) (name []byte, nameAt, argsAt int, ok bool) {
+	start := 0
+	lineComment := bytes.HasPrefix(line, []byte("//"))
+	if lineComment || bytes.HasPrefix(line, []byte("/*")) {
+		start = 2
+	}
+	end := len(bytes.TrimSuffix(bytes.TrimRight(line, "\r\n"), []byte("*/")))
+	if end < start {
+		return nil, 0, 0, false // "/*/"
+	}
+
+	// directives of tools and compilers follow "//" directly...
+	if lineComment {
+		if n := directiveName(line[start:end]); n > 0 {
+			return line[start : start+n], start, skipBlanks(line[:end], start+n), true
+		}
+	}
+
+	// ...while build constraints and cgo flags may be indented
+	i := start
+	for i < end && (line[i] == ' ' || line[i] == '\t' || line[i] == '*') {
+		i++
+	}
+	for _, word := range []string{"+build", "#cgo"} {
+		if n := len(word); bytes.HasPrefix(line[i:end], []byte(word)) && (i+n == end || line[i+n] == ' ' || line[i+n] == '\t') {
+			return line[i : i+n], i, skipBlanks(line[:end], i+n), true
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// directiveName returns the length of the name of the directive that begins
+// s, or 0 if there is none
+func directiveName(s []byte) int {
+	for _, word := range []string{"line", "extern", "export", "nolint"} {
+		if n := len(word); bytes.HasPrefix(s, []byte(word)) && (n == len(s) || s[n] == ' ' || (word == "nolint" && s[n] == ':')) {
+			return n
+		}
+	}
+
+	// "tool:name", as go/ast recognizes directives
+	colon := bytes.IndexByte(s, ':')
+	if colon <= 0 || colon+1 >= len(s) || !isDirectiveChar(s[colon+1]) {
+		return 0
+	}
+	for _, c := range s[:colon] {
+		if !isDirectiveChar(c) {
+			return 0
+		}
+	}
+	n := colon + 1
+	for n < len(s) && s[n] != ' ' && s[n] != '\t' {
+		n++
+	}
+	return n
+}
+
+func isDirectiveChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('0' <= c && c <= '9')
+}
+
+// skipBlanks returns the offset of the first byte at or after i in s that is
+// not a space, a tab, or the colon that begins a list as in "//nolint:errcheck"
+func skipBlanks(s []byte, i int) int {
+	if i < len(s) && s[i] == ':' {
+		i++
+	}
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
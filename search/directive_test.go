@@ -0,0 +1,71 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_parseDirective(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+		args string
+		ok   bool
+	}{
+		{line: "//go:generate stringer -type=Op", name: "go:generate", args: "stringer -type=Op", ok: true},
+		{line: "//go:build linux && amd64", name: "go:build", args: "linux && amd64", ok: true},
+		{line: "//go:embed static/*", name: "go:embed", args: "static/*", ok: true},
+		{line: "//go:linkname now runtime.now", name: "go:linkname", args: "now runtime.now", ok: true},
+		{line: "//go:noinline", name: "go:noinline", args: "", ok: true},
+		{line: "//lint:ignore SA1019 deprecated", name: "lint:ignore", args: "SA1019 deprecated", ok: true},
+		{line: "//nolint", name: "nolint", args: "", ok: true},
+		{line: "//nolint:errcheck,gosec", name: "nolint", args: "errcheck,gosec", ok: true},
+		{line: "//export Add", name: "export", args: "Add", ok: true},
+		{line: "//line foo.go:10", name: "line", args: "foo.go:10", ok: true},
+		{line: "// +build linux darwin", name: "+build", args: "linux darwin", ok: true},
+		{line: "// #cgo LDFLAGS: -lm", name: "#cgo", args: "LDFLAGS: -lm", ok: true},
+		{line: "/* #cgo CFLAGS: -O2 */", name: "#cgo", args: "CFLAGS: -O2 ", ok: true},
+		{line: "#cgo pkg-config: png", name: "#cgo", args: "pkg-config: png", ok: true},
+		{line: " * #cgo LDFLAGS: -lz", name: "#cgo", args: "LDFLAGS: -lz", ok: true},
+
+		{line: "// go:generate is a directive in prose"},
+		{line: "// Note: this is prose"},
+		{line: "//Note: capitalized"},
+		{line: "//go: no name"},
+		{line: "//nolintplease"},
+		{line: "//exported"},
+		{line: "// +builder"},
+		{line: "//"},
+		{line: "/*/"},
+	}
+	for _, tt := range tests {
+		name, nameAt, argsAt, ok := parseDirective([]byte(tt.line))
+		if ok != tt.ok || string(name) != tt.name {
+			t.Errorf("parseDirective(%q) = %q, %v, want %q, %v", tt.line, name, ok, tt.name, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		line := strings.TrimSuffix(tt.line, "*/")
+		if tt.line[nameAt:nameAt+len(name)] != tt.name || line[argsAt:] != tt.args {
+			t.Errorf("parseDirective(%q) name at %d, args at %d: %q, want %q", tt.line, nameAt, argsAt, line[argsAt:], tt.args)
+		}
+	}
+}
+
+func Test_splitDirectiveQuery(t *testing.T) {
+	tests := []struct {
+		input, name, args string
+	}{
+		{"go:embed", "go:embed", ""},
+		{"go:linkname runtime\\.", "go:linkname", "runtime\\."},
+		{" nolint  errcheck ", "nolint", "errcheck"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if name, args := splitDirectiveQuery(tt.input); name != tt.name || args != tt.args {
+			t.Errorf("splitDirectiveQuery(%q) = %q, %q, want %q, %q", tt.input, name, args, tt.name, tt.args)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"launchpad.net/gommap"
+
+	// "github.com/MichaelTJones/walk"
+	"github.com/klauspost/compress/zstd"
+	// "github.com/mirtchovski/walk"
+)
+
+// errStopped abandons a directory walk once the search is satisfied
+var errStopped = errors.New("search stopped")
+
+func (s *Searcher) isVisible(name string) bool {
+	if !s.opt.Hidden {
+		for _, e := range strings.Split(name, string(os.PathSeparator)) {
+			if e != "" && e != "." && e != ".." && e[0] == '.' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Searcher) isGo(name string) bool {
+	if s.opt.AllFiles {
+		return true
+	}
+	if isCompressed(name) {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) // unwrap the compression suffix
+	}
+	return filepath.Ext(name) == ".go"
+}
+
+func isArchive(name string) bool {
+	if isCompressed(name) {
+		ext := filepath.Ext(name)
+		name = strings.TrimSuffix(name, ext) // unwrap the compression suffix
+	}
+	ext := filepath.Ext(name)
+	return ext == ".cpio" || ext == ".tar" || ext == ".zip"
+}
+
+func isBinary(source []byte) bool {
+	const byteLimit = 2 * 1024
+	const nonPrintLimit = 8 + 1 // one Unicode byte order mark is forgiven
+	nonPrint := 0
+	for i, c := range source {
+		if i > byteLimit {
+			break
+		}
+		if c < 32 && c != ' ' && c != '\n' && c != '\t' {
+			nonPrint++
+		}
+		if nonPrint > nonPrintLimit {
+			return true
+		}
+	}
+	return false
+}
+
+func isCompressed(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".bz2" || ext == ".gz" || ext == ".zst"
+}
+
+func (s *Searcher) decompress(oldName string, oldData []byte) (newName string, newData []byte, mapped bool, err error) {
+	ext := filepath.Ext(oldName)
+	if (ext == ".go" && len(oldData) > 0) || (ext == ".zip") {
+		return oldName, oldData, false, nil // nothing to do
+	}
+	if !s.opt.NoMap && ext == ".go" {
+		file, err := os.Open(oldName)
+		if err == nil {
+			mmap, err := gommap.Map(file.Fd(), gommap.PROT_READ, gommap.MAP_PRIVATE)
+			if err == nil {
+				err = mmap.Advise(gommap.MADV_SEQUENTIAL | gommap.MADV_WILLNEED)
+				// fmt.Printf("mmaped: %q len=%d head=%q\n", oldName, len(mmap), mmap[:32])
+				file.Close()
+				return oldName, []byte(mmap), true, err
+			}
+		}
+	}
+
+	var oldSize int64
+	var encoded, decoder io.Reader
+
+	// Select source of encoded data
+	switch {
+	case len(oldData) == 0:
+		// Read from named file
+		file, err := os.Open(oldName)
+		if err != nil {
+			s.println(err)
+			return oldName, nil, false, err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			s.println(err)
+			return oldName, nil, false, err
+		}
+		oldSize = info.Size()
+		encoded = file
+	default:
+		// Use provided data (likely reading from an archive)
+		oldSize = int64(len(oldData))
+		encoded = bytes.NewReader(oldData)
+	}
+
+	// Select decompression algorithm based on file extension
+	decompressed := false
+	switch {
+	case ext == ".bz2":
+		decoder, err = bzip2.NewReader(encoded), nil
+		decompressed = true
+	case ext == ".gz":
+		decoder, err = gzip.NewReader(encoded)
+		decompressed = true
+	case ext == ".zst":
+		decoder, err = zstd.NewReader(encoded)
+		decompressed = true
+	default:
+		decoder, err = encoded, nil // "just reading" is minimal compression
+	}
+	if err != nil {
+		s.println(err) // error creating the decoder
+		return oldName, nil, false, err
+	}
+
+	// Decompress the data
+	if newData, err = ioutil.ReadAll(decoder); err != nil {
+		s.println(err) // error using the decoder
+		return oldName, nil, false, err
+	}
+	if decompressed {
+		// Decompress the name ("sample.go.zst" → "sample.go")
+		newName = strings.TrimSuffix(oldName, ext)
+		s.printf("  %8d → %8d bytes (%6.3f×)  decompress and scan %s",
+			oldSize, len(newData), float64(len(newData))/float64(oldSize), oldName)
+	} else {
+		newName = oldName
+		s.printf("  %8d bytes  scan %s", len(newData), oldName)
+	}
+
+	return newName, newData, false, nil
+}
+
+// List scans the files named one per line in the named file.
+func (s *Searcher) List(name string) {
+	file, err := os.Open(name)
+	if err != nil {
+		s.println(err)
+		return
+	}
+
+	s.println("scanning list of files:", name)
+	scanner := bufio.NewScanner(file)
+	for !s.stopped() && scanner.Scan() {
+		s.File(scanner.Text())
+	}
+	file.Close()
+}
+
+// File scans the named file. Plain files may be Go source, compressed Go
+// source, or archives of either; directories are scanned for such files,
+// recursively when Options.Recursive is set.
+func (s *Searcher) File(name string) {
+	if s.stopped() || !s.isVisible(name) {
+		return
+	}
+
+	info, err := os.Lstat(name)
+	if err != nil {
+		s.println(err)
+		return
+	}
+
+	// process plain files
+	if info.Mode().IsRegular() {
+		s.processRegularFile(name)
+	} else if info.Mode().IsDir() { // process directories
+		switch s.opt.Recursive {
+		case false:
+			// process files in this directory
+			s.println("processing Go files in directory", name)
+
+			bases, err := ioutil.ReadDir(name)
+			if err != nil {
+				s.println(err)
+				return
+			}
+
+			// user request: honor .gitignore blacklist
+			var skip map[string]bool
+
+			foundGitIgnore := false
+			for _, base := range bases {
+				if base.Name() == ".gitignore" {
+					foundGitIgnore = true
+					break
+				}
+			}
+			if foundGitIgnore {
+				gi, err := os.Open(".gitignore")
+				if err == nil {
+					skip = make(map[string]bool)
+					skip[".gitignore"] = true
+					scanner := bufio.NewScanner(gi)
+					for scanner.Scan() {
+						skip[scanner.Text()] = true
+					}
+					gi.Close()
+				}
+			}
+
+			for _, base := range bases {
+				if s.stopped() {
+					return
+				}
+				if skip != nil && skip[base.Name()] {
+					s.printf("  skipping .gitignored file %q", base.Name())
+					continue
+				}
+				fullName := filepath.Join(name, base.Name())
+				if s.isVisible(fullName) && s.isGo(fullName) {
+					s.Scan(fullName, nil)
+				}
+			}
+		case true:
+			// process files in this directory hierarchy
+			s.println("processing Go files in and under directory", name)
+
+			walker := func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					s.println(err)
+					return err
+				}
+				if s.stopped() {
+					return errStopped
+				}
+				name := info.Name()
+
+				// user request: honor .gitignore blacklist
+				var skip map[string]bool
+
+				gi, err := os.Open(".gitignore")
+				if err == nil {
+					skip = make(map[string]bool)
+					skip[".gitignore"] = true
+					scanner := bufio.NewScanner(gi)
+					for scanner.Scan() {
+						skip[scanner.Text()] = true
+					}
+					gi.Close()
+				}
+
+				if info.IsDir() {
+					if !s.isVisible(name) {
+						s.println("skipping hidden directory", name)
+						return filepath.SkipDir
+					}
+				} else {
+					if skip != nil && skip[name] {
+						s.printf("  skipping .gitignored file %q", name)
+					} else if s.isVisible(path) && s.isGo(path) {
+						s.Scan(path, nil)
+					}
+				}
+				return nil
+			}
+
+			err = filepath.Walk(name, walker) // standard library walker
+			// err = walk.Walk(name, walker) // mtj concurrent walker
+			// err = Walk(name, walker) // standard library walker
+			if err != nil && err != errStopped {
+				s.println(err)
+			}
+		}
+	}
+}
+
+type readNexter interface {
+	Read(p []byte) (n int, err error)
+	Next() (string, error)
+}
+
+func (s *Searcher) processRegularFile(name string) {
+	var err error
+	var data []byte
+	if isArchive(name) && isCompressed(name) {
+		name, data, _, err = s.decompress(name, nil)
+		if err != nil {
+			s.println(err)
+			return
+		}
+	}
+
+	var archive io.Reader
+	switch {
+	case len(data) == 0:
+		f, err := os.Open(name)
+		if err != nil {
+			s.println(err)
+			return
+		}
+		defer f.Close()
+		archive = f
+	default:
+		archive = bytes.NewReader(data)
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case ext == ".cpio":
+		s.println("processing cpio archive", name)
+		r := newMultiReader(archive, ext, "")
+		s.scanFile(name, r)
+	case ext == ".tar":
+		s.println("processing tar archive", name)
+		r := newMultiReader(archive, ext, "")
+		s.scanFile(name, r)
+	case ext == ".zip":
+		s.println("processing zip archive:", name)
+		mr := newMultiReader(nil, ext, name)
+		s.scanFile(name, mr)
+	case s.isGo(name):
+		s.Scan(name, nil)
+	default:
+		s.println("skipping file with unrecognized extension:", name)
+	}
+}
+
+func (s *Searcher) scanFile(fileName string, r readNexter) {
+	for !s.stopped() {
+		name, err := r.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			s.println(err)
+			return
+		}
+
+		memberName := fileName + "::" + name // "archive.cpio::file.go"
+		if !s.isGo(name) {
+			s.println("skipping file with unrecognized extension:", memberName)
+			continue
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		bytes := buf.Bytes()
+		if err != nil {
+			s.println(err)
+			return
+		}
+		s.Scan(memberName, bytes)
+	}
+}
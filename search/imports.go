@@ -0,0 +1,65 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+)
+
+// splitImportQuery separates an import search into patterns for the alias
+// and the path. A search of one word, "^unsafe$", is for the path; one of two
+// words, as in Go source, is for the alias and then the path: "_ ." finds
+// imports for side effects.
+func splitImportQuery(input string) (alias, path string) {
+	input = strings.TrimSpace(input)
+	if i := strings.IndexAny(input, " \t"); i >= 0 {
+		return input[:i], strings.TrimSpace(input[i+1:])
+	}
+	return "", input
+}
+
+// importPattern rewrites a path ending in "/..." as the go command reads it,
+// matching the package and those below it: "golang.org/x/tools/..." matches
+// "golang.org/x/tools" and "golang.org/x/tools/go/packages"
+func importPattern(path string) string {
+	if prefix := strings.TrimSuffix(path, "/..."); prefix != path {
+		return `^` + regexp.QuoteMeta(prefix) + `(?:/.*)?$`
+	}
+	return path
+}
+
+// importName returns the name by which a file refers to an imported package:
+// its alias or, short of reading the package, a guess from its path as the
+// tools for the go command make it. The guess is the last element of the
+// path that is not a major version, without a "go-" prefix and up to what
+// may not be in a name: "gopkg.in/yaml.v3" is yaml and
+// "github.com/mattn/go-sqlite3/v2" is sqlite3.
+func importName(alias, path string) string {
+	if alias != "" {
+		return alias
+	}
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	for i := 0; i < len(name); i++ {
+		if !isIdentByte(name[i]) {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// isMajorVersion reports whether s is a major version suffix: "v2", "v10"
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"regexp"
+	"testing"
+)
+
+func Test_splitImportQuery(t *testing.T) {
+	tests := []struct {
+		input, alias, path string
+	}{
+		{"^unsafe$", "", "^unsafe$"},
+		{"_ .", "_", "."},
+		{" pb  /proto$ ", "pb", "/proto$"},
+	}
+	for _, tt := range tests {
+		if alias, path := splitImportQuery(tt.input); alias != tt.alias || path != tt.path {
+			t.Errorf("splitImportQuery(%q) = %q, %q, want %q, %q", tt.input, alias, path, tt.alias, tt.path)
+		}
+	}
+}
+
+func Test_importPattern(t *testing.T) {
+	re := regexp.MustCompile(importPattern("golang.org/x/tools/..."))
+	for _, path := range []string{"golang.org/x/tools", "golang.org/x/tools/go/packages"} {
+		if !re.MatchString(path) {
+			t.Errorf("%s does not match %s, want match", re, path)
+		}
+	}
+	for _, path := range []string{"golang.org/x/toolsmith", "golang.org/x/tool", "example.com/golang.org/x/tools"} {
+		if re.MatchString(path) {
+			t.Errorf("%s matches %s, want no match", re, path)
+		}
+	}
+	if p := importPattern("net/http"); p != "net/http" {
+		t.Errorf("importPattern(net/http) = %q, want unchanged", p)
+	}
+}
+
+func Test_importName(t *testing.T) {
+	tests := []struct {
+		alias, path, name string
+	}{
+		{"", "fmt", "fmt"},
+		{"", "net/http", "http"},
+		{"h", "net/http", "h"},
+		{"", "gopkg.in/yaml.v3", "yaml"},
+		{"", "github.com/mattn/go-sqlite3", "sqlite3"},
+		{"", "github.com/jackc/pgx/v5", "pgx"},
+		{"", "example.com/v2", "example"},
+		{"", "github.com/x/go-cmp-diff", "cmp"},
+	}
+	for _, tt := range tests {
+		if name := importName(tt.alias, tt.path); name != tt.name {
+			t.Errorf("importName(%q, %q) = %q, want %q", tt.alias, tt.path, name, tt.name)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type searchMode struct {
+	// c: search Comments ("//..." or "/*...*/")
+	C bool
+	// d: search Defined non-types (iota, nil, new, true,...)
+	D bool
+	// e: search identifiers where they are dEclared (func f, var x, x :=,
+	// parameters, results, ...). i includes them, so "iE" searches
+	// identifiers where they are used.
+	E bool
+	// f: search struct Field tags (`json:"name,omitempty"`) by key and value.
+	// not among "all" since it searches the same tokens as s.
+	F bool
+	// grep mode ?
+	G bool
+	// i: search Identifiers ([a-zA-Z][a-zA-Z0-9]*), declared or used
+	I bool
+	// k: search Keywords (if, for, func, go, ...)
+	K bool
+	// m: search Magic comments: directives (//go:generate, //nolint, #cgo)
+	// by name and arguments. not among "all" since it searches the same
+	// tokens as c.
+	M bool
+	// n: search Numbers as strings (255 as 255, 0.255, 1e255)
+	N bool
+	// o: search Operators (,+-*/[]{}()>>...)
+	O bool
+	// p: search Package names
+	P bool
+	// q: search string values, decoded ("\x41BC" as ABC, `raw` as raw). not
+	// among "all" since it searches the same tokens as s.
+	Q bool
+	// r: search Rune literals ('a', '\U00101234')
+	R bool
+	// s: search Strings ("quoted" or `raw`)
+	S bool
+	// t: search Types (bool, int, float64, map, ...)
+	T bool
+	// u: search rune literals by code point ('A' as 'A', '\x41', '\101', '\u0041')
+	U bool
+	// v: search numeric Values (255 as 0b1111_1111, 0377, 255, 0xff)
+	V bool
+	// w: search comments other than doc comments, Within code. not among
+	// "all" since it searches the same tokens as c.
+	W bool
+	// x: search selectors, X.Sel, as one token with X an imported package
+	// resolved to its path ("net/http.Get" for h.Get). not among "all" since
+	// it searches the same tokens as i.
+	X bool
+	// y: search doc comments, the groups before package, func, type, var, and
+	// const declarations. not among "all" since it searches the same tokens
+	// as c.
+	Y bool
+	// z: search import paths, unquoted, and their aliases. not among "all"
+	// since it searches the same tokens as s.
+	Z bool
+
+	// negative values match literals with a unary minus sign: the lexer can not
+	// decide when a "-" is a sign vs when it is a subtraction operator, so the
+	// mini-parser in scan does.
+	value     valueQuery     // literal values to match
+	codePoint codePointQuery // rune literal code points to match
+}
+
+// declarations reports whether identifiers are searched where they are
+// declared but not where they are used, or the reverse
+func (m searchMode) declarations() bool {
+	return m.E != m.I
+}
+
+// valueOnly reports whether the only classes searched are those that do not
+// match the whole search pattern as a regular expression: values (v) and code
+// points (u), which read it as a query, and struct tags (f), directives (m),
+// and imports (z), which split it into parts. The search pattern then need
+// not be a regular expression.
+func (m searchMode) valueOnly() bool {
+	return (m.F || m.M || m.U || m.V || m.Z) && !(m.C || m.D || m.E || m.I || m.K || m.N || m.O || m.P || m.Q || m.R || m.S || m.T || m.W || m.X || m.Y)
+}
+
+// valueError reports a value search pattern that is not a number or code
+// point. It is not fatal since "gg a name" searches all classes, values
+// included.
+type valueError struct {
+	err error
+}
+
+func (e *valueError) Error() string {
+	return e.err.Error()
+}
+
+func parseFirstArg(input string) (searchMode, error) {
+	result := searchMode{}
+	// a: search all of the following
+	if strings.Contains(input, "a") {
+		result.C = true
+		result.D = true
+		result.E = true
+		result.I = true
+		result.K = true
+		result.N = true
+		result.O = true
+		result.P = true
+		result.R = true
+		result.S = true
+		result.T = true
+		result.U = true
+		result.V = true
+	}
+
+	// initialize token class inclusion flags
+	for _, class := range input {
+		switch class {
+		case 'a':
+			// already noted
+		case 'c':
+			result.C = true
+		case 'C':
+			result.C = false
+		case 'd':
+			result.D = true
+		case 'D':
+			result.D = false
+		case 'e':
+			result.E = true
+		case 'E':
+			result.E = false
+		case 'f':
+			result.F = true
+		case 'F':
+			result.F = false
+		case 'g':
+			result.G = true
+		case 'i':
+			result.I = true
+			result.E = true
+		case 'I':
+			result.I = false
+			result.E = false
+		case 'k':
+			result.K = true
+		case 'K':
+			result.K = false
+		case 'm':
+			result.M = true
+		case 'M':
+			result.M = false
+		case 'n':
+			result.N = true
+		case 'N':
+			result.N = false
+		case 'o':
+			result.O = true
+		case 'O':
+			result.O = false
+		case 'p':
+			result.P = true
+		case 'P':
+			result.P = false
+		case 'q':
+			result.Q = true
+		case 'Q':
+			result.Q = false
+		case 'r':
+			result.R = true
+		case 'R':
+			result.R = false
+		case 's':
+			result.S = true
+		case 'S':
+			result.S = false
+		case 't':
+			result.T = true
+		case 'T':
+			result.T = false
+		case 'u':
+			result.U = true
+		case 'U':
+			result.U = false
+		case 'v':
+			result.V = true
+		case 'V':
+			result.V = false
+		case 'w':
+			result.W = true
+		case 'W':
+			result.W = false
+		case 'x':
+			result.X = true
+		case 'X':
+			result.X = false
+		case 'y':
+			result.Y = true
+		case 'Y':
+			result.Y = false
+		case 'z':
+			result.Z = true
+		case 'Z':
+			result.Z = false
+		default:
+			return result, fmt.Errorf("unrecognized token class '%c'", class)
+		}
+	}
+	return result, nil
+}
+
+func setupModeGG(args []string) (searchMode, error) {
+	if len(args) < 2 {
+		// not enough args received, complete args with empty strings
+		for i := len(args); i < 2; i++ {
+			args = append(args, "")
+		}
+	}
+	// handle "all" flag first before subsequent upper-case anti-flags
+	res, err := parseFirstArg(args[0])
+	if err != nil {
+		return res, err
+	}
+
+	// initialize numeric value matcher
+	var vErr error
+	if res.V && len(args[1]) > 0 {
+		res.value, err = parseValueQuery(args[1])
+		if err != nil {
+			res.V = false
+			res.value = nil
+			vErr = &valueError{err}
+		}
+	}
+
+	// initialize code point matcher
+	if res.U && len(args[1]) > 0 {
+		res.codePoint, err = parseCodePointQuery(args[1])
+		if err != nil {
+			res.U = false
+			res.codePoint = nil
+			if vErr == nil {
+				vErr = &valueError{err}
+			}
+		}
+	}
+	return res, vErr
+}
+
+// matcher searches for one pattern in its token classes
+type matcher struct {
+	pattern  string // reported in matches: the pattern as given, when one of several
+	mode     searchMode
+	dispatch []*bool
+	regex    *regexp.Regexp
+	tagKey   string // struct tag key whose value tagRegex matches, or "" for the whole tag
+	tagRegex *regexp.Regexp
+
+	// whole-token pattern for identifiers and keywords, or its regexp,
+	// "^(?:G.t)$", when it is not literal
+	literal []byte
+	token   *regexp.Regexp
+
+	// directives named as directiveName matches with arguments that
+	// directiveArgs matches, either of which matches anything when nil
+	directiveName *regexp.Regexp
+	directiveArgs *regexp.Regexp
+
+	// semantic mode: the object named by the pattern, "(*os.File).Close"
+	object string
+
+	// sequence mode: the tokens to match in turn
+	sequence []seqElement
+
+	// imports with aliases that importAlias matches, or any if it is nil,
+	// and paths that importPath matches
+	importAlias *regexp.Regexp
+	importPath  *regexp.Regexp
+}
+
+// copy returns a matcher with its own copy of the regular expression, for use
+// by one goroutine
+func (m *matcher) copy() *matcher {
+	c := *m
+	if m.regex != nil { // nil in semantic mode
+		c.regex = m.regex.Copy()
+	}
+	if m.token != nil {
+		c.token = m.token.Copy()
+	}
+	if m.tagRegex != nil {
+		c.tagRegex = m.tagRegex.Copy()
+	}
+	if m.directiveName != nil {
+		c.directiveName = m.directiveName.Copy()
+	}
+	if m.directiveArgs != nil {
+		c.directiveArgs = m.directiveArgs.Copy()
+	}
+	if m.importAlias != nil {
+		c.importAlias = m.importAlias.Copy()
+	}
+	if m.importPath != nil {
+		c.importPath = m.importPath.Copy()
+	}
+	return &c
+}
+
+// classLetters are those that may prefix a pattern, "ci:TODO"
+const classLetters = "acdefikmnopqrstuvwxyzCDEFIKMNOPQRSTUVWXYZ"
+
+// splitClasses separates a pattern's token class prefix, as in "c:TODO", from
+// the pattern. A pattern without a prefix, or with an empty one as in
+// ":std:x", has the given default classes.
+func splitClasses(input, classes string) (string, string) {
+	if i := strings.IndexByte(input, ':'); i >= 0 && isClassPrefix(input[:i]) {
+		if i > 0 {
+			classes = input[:i]
+		}
+		return classes, input[i+1:]
+	}
+	return classes, input
+}
+
+// isClassPrefix reports whether a pattern prefix names token classes: empty,
+// or class letters beginning with one that selects a class, "ci" or "aC",
+// each class named once. Text such as "TODO" and "Deprecated" is not.
+func isClassPrefix(prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if c := prefix[0]; c < 'a' || c > 'z' {
+		return false
+	}
+	seen := map[rune]bool{}
+	for _, c := range prefix {
+		if !strings.ContainsRune(classLetters, c) || seen[unicode.ToLower(c)] {
+			return false
+		}
+		seen[unicode.ToLower(c)] = true
+	}
+	return true
+}
+
+// getPattern rewrites a search pattern as directed by the fixed-string,
+// whole-word, and ignore-case options
+func getPattern(input string, fixed, word, ignoreCase bool) string {
+	if fixed {
+		input = regexp.QuoteMeta(input) // "fmt.Println" means just that
+	}
+	if word {
+		input = `\b(?:` + input + `)\b`
+	}
+	if ignoreCase {
+		input = `(?i)` + input
+	}
+	return input
+}
+
+// getLiteral returns the text of a search pattern that matches only one
+// string, or nil if it is a true regular expression. Identifiers and keywords
+// are compared to it directly in whole-word searches.
+func getLiteral(input string, fixed bool) []byte {
+	if fixed {
+		return []byte(input)
+	}
+	re, err := regexp.Compile(input)
+	if err != nil {
+		return nil
+	}
+	if prefix, complete := re.LiteralPrefix(); complete && prefix != "" {
+		return []byte(prefix)
+	}
+	return nil
+}
+
+func getRegexp(input string) (*regexp.Regexp, error) {
+	return regexp.Compile(input)
+}
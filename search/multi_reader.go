@@ -1,4 +1,4 @@
-package main
+package search
 
 import (
 	"archive/tar"
@@ -17,7 +17,7 @@ const (
 )
 
 // multiReader is a struct to allow us to treat all files
-// the same way. It implements the ReadNexter interface.
+// the same way. It implements the readNexter interface.
 // Every multiReader can have a single implementation
 // inside, a zip multiReader cannot be used to read tar files.
 type multiReader struct {
@@ -93,8 +93,7 @@ func newMultiReader(r io.Reader, ext string, name string) *multiReader {
 	case ".zip":
 		z, err := zip.OpenReader(name)
 		if err != nil {
-			println(err)
-			return &multiReader{}
+			return &multiReader{} // reported as "internal reader not found" by Next
 		}
 		return &multiReader{ext: eZIP, rZIP: z, zipIndex: -1}
 	}
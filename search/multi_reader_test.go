@@ -1,4 +1,4 @@
-package main
+package search
 
 import (
 	"bytes"
@@ -75,7 +75,7 @@ func Test_newMultiReader(t *testing.T) {
 				return args{
 					r:    r,
 					ext:  ".zip",
-					name: "testdata/source.zip",
+					name: "../testdata/source.zip",
 				}
 			},
 			want1: &multiReader{ext: eZIP, zipIndex: -1},
@@ -109,7 +109,7 @@ func Test_newMultiReader(t *testing.T) {
 }
 
 func Test_multiReader_Next(t *testing.T) {
-	zipMR := newMultiReader(&bytes.Buffer{}, ".zip", "testdata/source.zip")
+	zipMR := newMultiReader(&bytes.Buffer{}, ".zip", "../testdata/source.zip")
 	tests := []struct {
 		name    string
 		init    func(t *testing.T) *multiReader
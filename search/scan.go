@@ -0,0 +1,800 @@
+package search
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+
+	"launchpad.net/gommap"
+
+	"github.com/MichaelTJones/lex"
+)
+
+// class names of lexer token types, indexed like the dispatch table
+var className = []string{"", "", "comment", "identifier", "keyword", "operator", "rune", "", "string", "type", "defined", "number", ""}
+
+// liner splits text into lines, each including its trailing newline.
+type liner struct {
+	b []byte
+	t []byte
+}
+
+func newLiner(b []byte) *liner {
+	return &liner{b: b}
+}
+
+func (l *liner) scan() bool {
+	if len(l.b) == 0 {
+		return false
+	}
+	index := bytes.IndexByte(l.b, '\n')
+	if index < 0 {
+		l.t, l.b = l.b, nil
+	} else {
+		l.t, l.b = l.b[:index+1], l.b[index+1:]
+	}
+	return true
+}
+
+func (l *liner) text() []byte {
+	return l.t
+}
+
+func (l *liner) trim() []byte {
+	n := len(l.t)
+	if n > 0 && l.t[n-1] == '\n' {
+		return l.t[:n-1]
+	}
+	return l.t
+}
+
+// fileScan is the state of a scan through one file's tokens
+type fileScan struct {
+	m         *matcher // the pattern being matched
+	fold      bool     // compare whole-token literals without regard to case
+	lexer     *lex.Lexer
+	source    []byte
+	r         *Result
+	printLine int // last line reported
+	offset    int // byte offset of the current token
+
+	// inverted search: the line being examined, whether one of its tokens
+	// matched, and the first that did not
+	invert  bool
+	line    int
+	matched bool
+	pending *Match
+}
+
+// lineAt returns the source line containing offset, without its newline
+func (f *fileScan) lineAt(offset int) []byte {
+	start := bytes.LastIndexByte(f.source[:offset], '\n') + 1
+	end := bytes.IndexByte(f.source[offset:], '\n')
+	if end < 0 {
+		return f.source[start:]
+	}
+	return f.source[start : offset+end]
+}
+
+// add a match to the result. the match is reported at offset, begins and ends
+// at the file offsets in span, and lies in text, a line of the source. text is
+// copied since source may be mapped.
+func (f *fileScan) add(line, offset int, span []int, class string, token, text []byte) {
+	f.r.Matches = append(f.r.Matches, f.match(line, offset, span, class, token, text))
+	f.printLine = line
+}
+
+// match describes a match as add does, without adding it to the result
+func (f *fileScan) match(line, offset int, span []int, class string, token, text []byte) Match {
+	lineStart := bytes.LastIndexByte(f.source[:offset], '\n') + 1
+	m := Match{
+		Line:    line,
+		Column:  offset - lineStart + 1,
+		Offset:  offset,
+		Class:   class,
+		Pattern: f.m.pattern,
+		Token:   string(token),
+		Text:    string(text),
+		Start:   span[0] - lineStart,
+		End:     span[1] - lineStart,
+	}
+	if f.lexer != nil { // nil in AST mode
+		m.Subtype = int(f.lexer.Subtype)
+	}
+	if m.End > len(m.Text) {
+		m.End = len(m.Text)
+	}
+	return m
+}
+
+// span of the current token
+func (f *fileScan) span(text []byte) []int {
+	return []int{f.offset, f.offset + len(text)}
+}
+
+// advance past the current token
+func (f *fileScan) advance(text []byte) {
+	f.offset += len(text)
+}
+
+func (f *fileScan) tokenHandler(class string, text []byte) {
+	lexer := f.lexer
+	if f.invert {
+		f.invertHandler(class, text)
+	} else if lexer.Type == lex.String && lexer.Subtype == lex.Raw && bytes.Count(text, []byte{'\n'}) > 0 {
+		f.linesHandler(class, text) // match each line of the raw string individually
+	} else if lexer.Type == lex.Comment && lexer.Subtype == lex.Block && bytes.Count(text, []byte{'\n'}) > 0 {
+		f.linesHandler(class, text) // match each line of the block comment individually
+	} else if f.m.wholeToken() && (lexer.Type == lex.Identifier || lexer.Type == lex.Keyword) {
+		if f.printLine < lexer.Line && f.equal(text) {
+			// the whole token is the match
+			f.r.Summary.Matches++
+			f.add(lexer.Line, f.offset, f.span(text), class, text, lexer.GetLine())
+		}
+	} else if f.printLine < lexer.Line && f.m.regex.Match(text) {
+		// match the token but print the line that contains it
+		f.r.Summary.Matches++
+		loc := f.m.regex.FindIndex(text)
+		f.add(lexer.Line, f.offset, []int{f.offset + loc[0], f.offset + loc[1]}, class, text, lexer.GetLine())
+	}
+}
+
+// wholeToken reports whether identifiers and keywords match only as a whole
+func (m *matcher) wholeToken() bool {
+	return m.literal != nil || m.token != nil
+}
+
+// equal reports whether the whole token is the pattern
+func (f *fileScan) equal(text []byte) bool {
+	if f.m.literal == nil {
+		return f.m.token.Match(text)
+	}
+	if f.fold {
+		return bytes.EqualFold(text, f.m.literal)
+	}
+	return bytes.Equal(text, f.m.literal)
+}
+
+// invertHandler notes whether the token matches, line by line for tokens
+// that span lines
+func (f *fileScan) invertHandler(class string, text []byte) {
+	lexer := f.lexer
+	whole := f.m.wholeToken() && (lexer.Type == lex.Identifier || lexer.Type == lex.Keyword)
+	line := lexer.Line
+	start := f.offset // offset of this line's part of the token
+	liner := newLiner(text)
+	for liner.scan() {
+		if line != f.line || !f.matched { // once a line matches, its other tokens do not matter
+			var matched bool
+			if whole {
+				matched = f.equal(liner.text())
+			} else {
+				matched = f.m.regex.Match(liner.text())
+			}
+			f.note(line, start, class, liner.trim(), matched)
+		}
+		start += len(liner.text())
+		line++
+	}
+}
+
+// note a token of a selected class at offset on line, and whether it matched.
+// lines with such tokens but no match are the result of an inverted search.
+func (f *fileScan) note(line, offset int, class string, token []byte, matched bool) {
+	if line != f.line {
+		f.flush()
+		f.line = line
+	}
+	switch {
+	case matched:
+		f.matched = true
+	case f.pending == nil:
+		// report the line at its first token that did not match
+		m := f.match(line, offset, []int{offset, offset}, class, token, f.lineAt(offset))
+		m.Pattern = "" // none matched
+		f.pending = &m
+	}
+}
+
+// flush reports the line being examined by an inverted search if none of its
+// tokens matched
+func (f *fileScan) flush() {
+	if f.pending != nil && !f.matched {
+		f.r.Summary.Matches++
+		f.r.Matches = append(f.r.Matches, *f.pending)
+	}
+	f.matched = false
+	f.pending = nil
+}
+
+// linesHandler matches each line of a multi-line token individually,
+// reporting the position of the match within the line
+func (f *fileScan) linesHandler(class string, text []byte) {
+	lineInString := 0
+	start := f.offset // offset of this line's part of the token
+	liner := newLiner(text)
+	for liner.scan() {
+		if loc := f.m.regex.FindIndex(liner.text()); loc != nil {
+			f.r.Summary.Matches++
+			line := f.lexer.Line + lineInString
+			if f.printLine < line {
+				f.add(line, start+loc[0], []int{start + loc[0], start + loc[1]}, class, liner.trim(), f.lineAt(start))
+			}
+		}
+		start += len(liner.text())
+		lineInString++
+	}
+}
+
+// decodedHandler matches the value of a string literal rather than its
+// spelling, each line individually for multi-line raw strings, reporting
+// positions in the source
+func (f *fileScan) decodedHandler(text []byte) {
+	value, at := decodeString(text)
+	if value == nil {
+		return // not a valid string literal
+	}
+	raw := text[0] == '`'
+	line := f.lexer.Line
+	for i := 0; i < len(value) || i == 0; {
+		// the value, or a line of a raw string's value
+		j := len(value)
+		if k := bytes.IndexByte(value[i:], '\n'); raw && k >= 0 {
+			j = i + k
+		}
+		segment := value[i:j]
+		start := f.offset + at[i]
+		if f.invert {
+			if line != f.line || !f.matched {
+				f.note(line, start, "decoded", segment, f.m.regex.Match(segment))
+			}
+		} else if loc := f.m.regex.FindIndex(segment); loc != nil {
+			f.r.Summary.Matches++
+			if f.printLine < line {
+				from, to := f.offset+at[i+loc[0]], f.offset+at[i+loc[1]]
+				f.add(line, from, []int{from, to}, "decoded", segment, f.lineAt(from))
+			}
+		}
+		if j == len(value) {
+			break
+		}
+		i = j + 1
+		line++
+	}
+}
+
+// tagHandler matches a struct field tag by the value of its key, as
+// reflect.StructTag would read it, or as a whole
+func (f *fileScan) tagHandler(text []byte) {
+	tag, at := decodeString(text)
+	if tag == nil {
+		return // not a valid string literal
+	}
+	var span []int
+	if f.m.tagKey == "" {
+		if loc := f.m.tagRegex.FindIndex(tag); loc != nil {
+			span = []int{f.offset + at[loc[0]], f.offset + at[loc[1]]}
+		}
+	} else if value, start, end, ok := lookupTag(string(tag), f.m.tagKey); ok && f.m.tagRegex.MatchString(value) {
+		span = []int{f.offset + at[start], f.offset + at[end]} // the quoted value
+	}
+
+	line := f.lexer.Line
+	if f.invert {
+		f.note(line, f.offset, "tag", text, span != nil)
+	} else if span != nil {
+		f.r.Summary.Matches++
+		if f.printLine < line {
+			f.add(line, f.offset, span, "tag", text, f.lexer.GetLine())
+		}
+	}
+}
+
+// directiveHandler matches the directives in each line of a comment by
+// name and arguments
+func (f *fileScan) directiveHandler(text []byte) {
+	line := f.lexer.Line
+	start := f.offset // offset of this line's part of the comment
+	liner := newLiner(text)
+	for liner.scan() {
+		var span []int
+		name, nameAt, argsAt, ok := parseDirective(liner.trim())
+		if ok && (f.m.directiveName == nil || f.m.directiveName.Match(name)) {
+			args := liner.trim()[argsAt:]
+			if f.m.directiveArgs == nil {
+				span = []int{start + nameAt, start + nameAt + len(name)}
+			} else if loc := f.m.directiveArgs.FindIndex(args); loc != nil {
+				span = []int{start + argsAt + loc[0], start + argsAt + loc[1]}
+			}
+		}
+		if f.invert {
+			if ok {
+				f.note(line, start, "directive", liner.trim(), span != nil)
+			}
+		} else if span != nil {
+			f.r.Summary.Matches++
+			if f.printLine < line {
+				f.add(line, span[0], span, "directive", liner.trim(), f.lineAt(start))
+			}
+		}
+		start += len(liner.text())
+		line++
+	}
+}
+
+// importHandler matches an import by its unquoted path and its alias
+func (f *fileScan) importHandler(text, alias []byte) {
+	path, at := decodeString(text)
+	if path == nil {
+		return // not a valid string literal
+	}
+	var span []int
+	if f.m.importAlias == nil || (alias != nil && f.m.importAlias.Match(alias)) {
+		if loc := f.m.importPath.FindIndex(path); loc != nil {
+			span = []int{f.offset + at[loc[0]], f.offset + at[loc[1]]}
+		}
+	}
+
+	line := f.lexer.Line
+	if f.invert {
+		f.note(line, f.offset, "import", path, span != nil)
+	} else if span != nil {
+		f.r.Summary.Matches++
+		if f.printLine < line {
+			f.add(line, f.offset, span, "import", path, f.lexer.GetLine())
+		}
+	}
+}
+
+// selectorHandler matches a selector, x.sel, starting at start on line and
+// ending with the current token. When x names an imported package and is not
+// itself selected from another, as b in "a.b.c", it is matched as the
+// package's path: "net/http.Get" for "h.Get".
+func (f *fileScan) selectorHandler(x, sel []byte, path string, start, line int, chained bool) {
+	name := string(x) + "." + string(sel)
+	if path != "" && !chained {
+		name = path + "." + string(sel)
+	}
+	loc := f.m.regex.FindStringIndex(name)
+	if f.invert {
+		f.note(line, start, "selector", []byte(name), loc != nil)
+		return
+	}
+	if loc == nil {
+		return
+	}
+	f.r.Summary.Matches++
+	if f.printLine < line {
+		end := f.offset + len(sel)
+		span := []int{start, end}
+		if string(f.source[start:end]) == name {
+			span = []int{start + loc[0], start + loc[1]} // the name as written
+		}
+		f.add(line, start, span, "selector", []byte(name), f.lineAt(start))
+	}
+}
+
+// decodeString returns the value of a string literal and, for each byte of
+// the value and for its end, the offset in the literal where its spelling
+// begins. The value is nil if the literal is not valid.
+func decodeString(text []byte) ([]byte, []int) {
+	if len(text) < 2 || (text[0] != '"' && text[0] != '`') || text[len(text)-1] != text[0] {
+		return nil, nil
+	}
+	value, at := []byte{}, []int{}
+	if text[0] == '`' {
+		for i, c := range text[1 : len(text)-1] {
+			if c != '\r' { // carriage returns are discarded from raw strings
+				value = append(value, c)
+				at = append(at, i+1)
+			}
+		}
+		return value, append(at, len(text)-1)
+	}
+	s := string(text[1 : len(text)-1])
+	for offset := 1; len(s) > 0; {
+		r, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return nil, nil
+		}
+		n := len(value)
+		if r < utf8.RuneSelf || !multibyte {
+			value = append(value, byte(r)) // "\xff" is a byte, not a code point
+		} else {
+			var b [utf8.UTFMax]byte
+			value = append(value, b[:utf8.EncodeRune(b[:], r)]...)
+		}
+		for range value[n:] {
+			at = append(at, offset)
+		}
+		offset += len(s) - len(tail)
+		s = tail
+	}
+	return value, append(at, len(text)-1)
+}
+
+func (s *Searcher) scan(matchers []*matcher, name string, source []byte) *Result {
+	r := &Result{Name: name}
+	var err error
+	var newName string
+	var mapped bool
+	newName, source, mapped, err = s.decompress(name, source)
+	if err != nil {
+		return r
+	}
+	defer func() { // however the file is searched
+		s.addContext(r, source)
+		if mapped {
+			// finished using []byte source so unmap file to free the file descriptor
+			gommap.MMap(source).UnsafeUnmap()
+		}
+	}()
+
+	if s.opt.AllFiles && isBinary(source) {
+		// enable printf if desired. makes log cluttered:
+		// s.printf("skipping binary file %s", newName)
+		return r
+	}
+
+	r.Name = newName
+	r.Summary.Bytes = len(source)
+	r.Summary.Lines = bytes.Count(source, []byte{'\n'})
+	r.Summary.Files = 1
+
+	// handle grep mode
+	if s.grep {
+		fileLine := 0
+		offset := 0
+		liner := newLiner(source)
+		for !s.enough(r) && liner.scan() {
+			fileLine++
+			m := firstMatch(matchers, liner.text())
+			if s.opt.Invert && m == nil {
+				r.Summary.Matches++
+				r.Matches = append(r.Matches, Match{
+					Line:   fileLine,
+					Column: 1,
+					Offset: offset,
+					Text:   string(liner.trim()),
+				})
+			} else if !s.opt.Invert && m != nil {
+				r.Summary.Matches++
+				loc := m.regex.FindIndex(liner.text()) // position only when needed
+				line := liner.trim()
+				if loc[1] > len(line) {
+					loc[1] = len(line) // the newline is not part of the text
+				}
+				if loc[0] > loc[1] {
+					loc[0] = loc[1]
+				}
+				r.Matches = append(r.Matches, Match{
+					Line:    fileLine,
+					Column:  loc[0] + 1,
+					Offset:  offset + loc[0],
+					Pattern: m.pattern,
+					Token:   string(liner.text()[loc[0]:loc[1]]),
+					Text:    string(line),
+					Start:   loc[0],
+					End:     loc[1],
+				})
+			}
+			offset += len(liner.text())
+		}
+		return r
+	}
+
+	// report the objects found by type checking in semantic mode
+	if s.semantic != nil {
+		s.scanSemantic(newName, source, r)
+		return r
+	}
+
+	// match runs of tokens in sequence mode
+	if s.opt.Sequence {
+		s.scanSequences(matchers, source, r)
+		return r
+	}
+
+	// search syntax nodes in AST mode, falling back to tokens when the
+	// file does not parse
+	if s.ast != nil && s.scanAST(matchers, newName, source, r) {
+		return r
+	}
+
+	// Perform the scan by tabulating token types, subtypes, and values
+	// lexer := &lex.Lexer{Input: source, Mode: lex.ScanGo} // | lex.SkipSpace}
+	lexer := lex.NewLexer(source, lex.ScanGo)
+	f := &fileScan{fold: s.opt.IgnoreCase, lexer: lexer, source: source, r: r, invert: s.opt.Invert}
+	expectPackageName := false
+	operand := true     // the next significant token begins an operand
+	signed := false     // unary signs precede the current token...
+	negative := false   // ...with this net effect...
+	signStart := 0      // ...starting at this offset
+	var brackets []byte // open brackets, with 's' for struct bodies...
+	structType := false // ...which follow the keyword "struct"
+	codeLine := 0       // line where the last token other than a comment ends
+	groupEnd := 0       // end of the current comment group...
+	groupDoc := false   // ...and whether it documents a declaration
+	imports := 0        // in an import declaration: 1 for one import, 2 for a group...
+	var alias []byte    // ...with this alias for the next path
+
+	packages := map[string]string{} // import paths by the names used for them
+	var selX []byte                 // an identifier that may begin a selector, X.Sel...
+	selStart, selLine := 0, 0       // ...at this offset and line...
+	selDot := false                 // ...followed by "."...
+	selChain := false               // ...and itself a selector's Sel, so not a package
+
+	// go/parser finds declaring identifiers for patterns that need them
+	var decls map[int]bool
+	for _, m := range matchers {
+		if m.mode.declarations() {
+			decls = declarations(newName, source)
+			break
+		}
+	}
+
+	for tok, text := lexer.Scan(); tok != lex.EOF && !s.enough(r); tok, text = lexer.Scan() {
+		r.Summary.Tokens++
+
+		// go mini-parser: expect package name after "package" keyword
+		packageName := false
+		if expectPackageName && tok == lex.Identifier {
+			packageName = true
+			expectPackageName = false
+		} else if tok == lex.Keyword && bytes.Equal(text, []byte("package")) {
+			expectPackageName = true // set expectations
+		}
+
+		// go mini-parser: a string directly in a struct body is a field tag
+		fieldTag := tok == lex.String && len(brackets) > 0 && brackets[len(brackets)-1] == 's'
+
+		// go mini-parser: a string in an import declaration is a path
+		importPath := tok == lex.String && imports > 0
+
+		// go mini-parser: look ahead past a comment group for the declaration
+		// it documents. a comment after code on its line is not a doc comment.
+		docComment := false
+		if tok == lex.Comment {
+			if f.offset >= groupEnd {
+				if lexer.Line == codeLine {
+					groupEnd, groupDoc = 0, false
+				} else {
+					groupEnd, groupDoc = commentGroup(source, f.offset+len(text))
+				}
+			}
+			docComment = groupDoc && f.offset < groupEnd
+		}
+
+		// go mini-parser: an identifier after "X." completes a selector
+		selector := tok == lex.Identifier && selDot
+
+		// an identifier is declared here or used, as go/parser finds
+		declared := tok == lex.Identifier && decls[f.offset]
+
+		// each pattern in turn. a line is reported once, for the first to match
+		for _, m := range matchers {
+			f.m = m
+			if packageName && m.mode.P && f.invert {
+				f.note(lexer.Line, f.offset, "package", text, m.regex.Match(text))
+			} else if packageName && m.mode.P && m.regex.Match(text) {
+				r.Summary.Matches++
+				if f.printLine < lexer.Line {
+					f.add(lexer.Line, f.offset, f.span(text), "package", text, lexer.GetLine())
+				}
+			}
+
+			if tok < 0 {
+				if declared {
+					if m.mode.E {
+						f.tokenHandler(className[-tok], text)
+					}
+				} else if d := m.dispatch[-tok]; d != nil && *d {
+					f.tokenHandler(className[-tok], text)
+				}
+				if tok == lex.Number && m.mode.V {
+					// a signed value begins at its sign: "-1" or "- 0x1"
+					start := f.offset
+					if signed {
+						start = signStart
+					}
+					value := f.source[start : f.offset+len(text)]
+					if f.invert {
+						f.note(lexer.Line, start, "value", value, m.isValue(text, negative))
+					} else if f.printLine < lexer.Line && m.isValue(text, negative) {
+						// match the token but print the line
+						r.Summary.Matches++
+						f.add(lexer.Line, start, []int{start, f.offset + len(text)}, "value", value, lexer.GetLine())
+					}
+				}
+				if tok == lex.Comment && docComment && m.mode.Y {
+					f.tokenHandler("doc comment", text)
+				} else if tok == lex.Comment && !docComment && m.mode.W {
+					f.tokenHandler("comment", text)
+				}
+				if tok == lex.Comment && m.mode.M {
+					f.directiveHandler(text)
+				}
+				if selector && m.mode.X {
+					f.selectorHandler(selX, text, packages[string(selX)], selStart, selLine, selChain)
+				}
+				if importPath && m.mode.Z {
+					f.importHandler(text, alias)
+				}
+				if fieldTag && m.mode.F {
+					f.tagHandler(text)
+				}
+				if tok == lex.String && m.mode.Q {
+					f.decodedHandler(text)
+				}
+				if tok == lex.Rune && m.mode.U {
+					if f.invert {
+						f.note(lexer.Line, f.offset, "code point", text, m.isCodePoint(text))
+					} else if f.printLine < lexer.Line && m.isCodePoint(text) {
+						r.Summary.Matches++
+						f.add(lexer.Line, f.offset, f.span(text), "code point", text, lexer.GetLine())
+					}
+				}
+			}
+		}
+
+		// go mini-parser: "-" is a sign rather than subtraction when it begins
+		// an operand, as after an operator other than a closing bracket, after
+		// a keyword ("return -1"), or at the start
+		if tok != lex.Comment && len(bytes.TrimSpace(text)) > 0 {
+			operator := tok < 0 && className[-tok] == "operator"
+			if operator && operand && (bytes.Equal(text, []byte("-")) || bytes.Equal(text, []byte("+"))) {
+				if !signed {
+					signStart = f.offset
+				}
+				signed = true
+				negative = negative != (text[0] == '-') // "- -1" is 1
+			} else {
+				closing := bytes.Equal(text, []byte(")")) || bytes.Equal(text, []byte("]")) || bytes.Equal(text, []byte("}"))
+				operand = (operator && !closing) || tok == lex.Keyword
+				signed = false
+				negative = false
+			}
+
+			// go mini-parser: track brackets to find struct bodies
+			if operator && len(text) == 1 {
+				switch text[0] {
+				case '{':
+					if structType {
+						brackets = append(brackets, 's')
+					} else {
+						brackets = append(brackets, '{')
+					}
+				case '(', '[':
+					brackets = append(brackets, text[0])
+				case ')', ']', '}':
+					if len(brackets) > 0 {
+						brackets = brackets[:len(brackets)-1]
+					}
+				}
+			}
+			structType = tok == lex.Keyword && bytes.Equal(text, []byte("struct"))
+
+			// go mini-parser: follow import declarations, one or a group
+			switch {
+			case tok == lex.Keyword && bytes.Equal(text, []byte("import")):
+				imports, alias = 1, nil
+			case imports == 1 && alias == nil && bytes.Equal(text, []byte("(")):
+				imports = 2
+			case imports == 2 && bytes.Equal(text, []byte(")")):
+				imports = 0
+			case imports > 0 && tok == lex.String:
+				if path, err := strconv.Unquote(string(text)); err == nil && !bytes.Equal(alias, []byte("_")) && !bytes.Equal(alias, []byte(".")) {
+					packages[importName(string(alias), path)] = path
+				}
+				alias = nil
+				if imports == 1 {
+					imports = 0
+				}
+			case imports > 0 && (tok == lex.Identifier || bytes.Equal(text, []byte("."))):
+				alias = text // "_", ".", or a name
+			}
+
+			// go mini-parser: follow selectors, identifier "." identifier,
+			// including those in chains as "a.b.c"
+			switch {
+			case tok == lex.Identifier:
+				selX, selStart, selLine, selChain, selDot = text, f.offset, lexer.Line, selDot, false
+			case selX != nil && !selDot && bytes.Equal(text, []byte(".")):
+				selDot = true
+			default:
+				selX, selDot = nil, false
+			}
+		}
+		if tok != lex.Comment && len(bytes.TrimSpace(text)) > 0 {
+			codeLine = lexer.Line + bytes.Count(text, []byte{'\n'})
+		}
+		f.advance(text)
+	}
+	if f.invert && !s.enough(r) {
+		f.flush() // the last line
+	}
+	return r
+}
+
+// firstMatch returns the first matcher with a match in text, or nil if none
+func firstMatch(matchers []*matcher, text []byte) *matcher {
+	for _, m := range matchers {
+		if m.regex.Match(text) {
+			return m
+		}
+	}
+	return nil
+}
+
+// isValue reports whether the number literal, negated when neg is set, has
+// a value searched for
+func (m *matcher) isValue(text []byte, neg bool) bool {
+	lit, err := parseLiteral(text, neg)
+	return err == nil && m.mode.value.match(lit)
+}
+
+// isCodePoint reports whether the rune literal has a code point searched for
+func (m *matcher) isCodePoint(text []byte) bool {
+	r, ok := unquoteRune(text)
+	return ok && m.mode.codePoint.match(r)
+}
+
+// enough reports whether the scan of a file may stop: it has MaxCount matches
+// or the search as a whole is satisfied
+func (s *Searcher) enough(r *Result) bool {
+	return (s.opt.MaxCount > 0 && len(r.Matches) >= s.opt.MaxCount) || s.stopped()
+}
+
+// addContext attaches the requested lines of context to each match while the
+// source, which may be mapped or exist only in memory, is still at hand
+func (s *Searcher) addContext(r *Result, source []byte) {
+	if (s.opt.Before <= 0 && s.opt.After <= 0) || len(r.Matches) == 0 {
+		return
+	}
+
+	// byte offset of the start of each line: line n starts at starts[n-1]
+	starts := []int{0}
+	for i := 0; ; {
+		n := bytes.IndexByte(source[i:], '\n')
+		if n < 0 || i+n+1 == len(source) {
+			break
+		}
+		i += n + 1
+		starts = append(starts, i)
+	}
+	line := func(n int) Line {
+		text := source[starts[n-1]:]
+		if n < len(starts) {
+			text = source[starts[n-1] : starts[n]-1]
+		}
+		return Line{Line: n, Text: string(bytes.TrimSuffix(text, []byte{'\n'}))}
+	}
+
+	last := 0 // last line reported, as match or context
+	for i := range r.Matches {
+		m := &r.Matches[i]
+		first := m.Line - s.opt.Before
+		if first <= last {
+			first = last + 1 // merge with context of previous match
+		}
+		for n := first; n < m.Line; n++ {
+			m.Before = append(m.Before, line(n))
+		}
+
+		end := m.Line + s.opt.After
+		if end > len(starts) {
+			end = len(starts)
+		}
+		if i+1 < len(r.Matches) && end >= r.Matches[i+1].Line {
+			end = r.Matches[i+1].Line - 1 // merge with next match
+		}
+		for n := m.Line + 1; n <= end; n++ {
+			m.After = append(m.After, line(n))
+		}
+
+		last = m.Line
+		if end > last {
+			last = end
+		}
+	}
+}
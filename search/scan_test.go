@@ -1,13 +1,14 @@
-package main
+package search
 
 import (
+	"math/big"
 	"reflect"
 	"regexp"
 	"testing"
 )
 
 func Test_visibleWithFlagSet(t *testing.T) {
-	*flagVisible = true
+	s := &Searcher{opt: Options{Hidden: false}}
 	type args struct {
 		name string
 	}
@@ -54,7 +55,7 @@ func Test_visibleWithFlagSet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tArgs := tt.args(t)
 
-			got1 := isVisible(tArgs.name)
+			got1 := s.isVisible(tArgs.name)
 
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("visible got1 = %v, want1: %v", got1, tt.want1)
@@ -64,8 +65,8 @@ func Test_visibleWithFlagSet(t *testing.T) {
 }
 
 func Test_visibleWithoutFlagSet(t *testing.T) {
-	// flagVisible = false means that we will show results for hidden files
-	*flagVisible = false
+	// Hidden = true means that we will show results for hidden files
+	s := &Searcher{opt: Options{Hidden: true}}
 	type args struct {
 		name string
 	}
@@ -112,7 +113,7 @@ func Test_visibleWithoutFlagSet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tArgs := tt.args(t)
 
-			got1 := isVisible(tArgs.name)
+			got1 := s.isVisible(tArgs.name)
 
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("visible got1 = %v, want1: %v", got1, tt.want1)
@@ -178,7 +179,7 @@ func Test_isCompressed(t *testing.T) {
 }
 
 func Test_isGoWithFlagSet(t *testing.T) {
-	*flagGo = true
+	s := &Searcher{opt: Options{AllFiles: false}}
 	type args struct {
 		name string
 	}
@@ -234,7 +235,7 @@ func Test_isGoWithFlagSet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tArgs := tt.args(t)
 
-			got1 := isGo(tArgs.name)
+			got1 := s.isGo(tArgs.name)
 
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("isGo got1 = %v, want1: %v", got1, tt.want1)
@@ -244,8 +245,8 @@ func Test_isGoWithFlagSet(t *testing.T) {
 }
 
 func Test_isGoWithoutFlagSet(t *testing.T) {
-	// with this flag set to false our search isn't limited to .go files
-	*flagGo = false
+	// with AllFiles set our search isn't limited to .go files
+	s := &Searcher{opt: Options{AllFiles: true}}
 	type args struct {
 		name string
 	}
@@ -272,7 +273,7 @@ func Test_isGoWithoutFlagSet(t *testing.T) {
 		},
 
 		{
-			name: "anything should pass when flagGo = false",
+			name: "anything should pass when AllFiles = true",
 			args: func(*testing.T) args {
 				return args{name: "test.zip.exe"}
 			},
@@ -284,7 +285,7 @@ func Test_isGoWithoutFlagSet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tArgs := tt.args(t)
 
-			got1 := isGo(tArgs.name)
+			got1 := s.isGo(tArgs.name)
 
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("isGo got1 = %v, want1: %v", got1, tt.want1)
@@ -357,6 +358,34 @@ func Test_isArchive(t *testing.T) {
 	}
 }
 
+func Test_decodeString(t *testing.T) {
+	tests := []struct {
+		text  string
+		value string
+		at    []int
+	}{
+		{text: `"abc"`, value: "abc", at: []int{1, 2, 3, 4}},
+		{text: `"\x41B"`, value: "AB", at: []int{1, 5, 6}},
+		{text: `"\u00e9!"`, value: "é!", at: []int{1, 1, 7, 8}},
+		{text: `"é"`, value: "é", at: []int{1, 1, 3}},
+		{text: `"\xff"`, value: "\xff", at: []int{1, 5}},
+		{text: `""`, value: "", at: []int{1}},
+		{text: "`a\\n`", value: `a\n`, at: []int{1, 2, 3, 4}},
+		{text: "`a\r\nb`", value: "a\nb", at: []int{1, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		value, at := decodeString([]byte(tt.text))
+		if string(value) != tt.value || !reflect.DeepEqual(at, tt.at) {
+			t.Errorf("decodeString(%s) = %q, %v, want %q, %v", tt.text, value, at, tt.value, tt.at)
+		}
+	}
+	for _, text := range []string{`"\q"`, `"abc`, "'a'", `"`} {
+		if value, _ := decodeString([]byte(text)); value != nil {
+			t.Errorf("decodeString(%s) = %q, want nil", text, value)
+		}
+	}
+}
+
 func Test_parseFirstArg(t *testing.T) {
 	type args struct {
 		input string
@@ -375,6 +404,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -383,6 +413,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -405,6 +436,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: false,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -413,6 +445,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -435,6 +468,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: false,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -443,6 +477,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -452,6 +487,37 @@ func Test_parseFirstArg(t *testing.T) {
 			args: func(*testing.T) args {
 				return args{input: "i"}
 			},
+			want1: searchMode{
+				E: true,
+				I: true,
+			},
+		},
+
+		{
+			name: "'e' should include only declaring identifiers",
+			args: func(*testing.T) args {
+				return args{input: "e"}
+			},
+			want1: searchMode{
+				E: true,
+			},
+		},
+
+		{
+			name: "'x' should include only selectors",
+			args: func(*testing.T) args {
+				return args{input: "x"}
+			},
+			want1: searchMode{
+				X: true,
+			},
+		},
+
+		{
+			name: "'iE' should include only using identifiers",
+			args: func(*testing.T) args {
+				return args{input: "iE"}
+			},
 			want1: searchMode{
 				I: true,
 			},
@@ -473,6 +539,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -495,6 +562,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: false,
 				N: true,
@@ -503,6 +571,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -525,6 +594,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: false,
@@ -533,6 +603,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -555,6 +626,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -563,6 +635,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -585,6 +658,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -593,6 +667,60 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
+				V: true,
+			},
+		},
+
+		{
+			name: "'f' should include only struct field tags",
+			args: func(*testing.T) args {
+				return args{input: "f"}
+			},
+			want1: searchMode{
+				F: true,
+			},
+		},
+
+		{
+			name: "'m' should include only directives",
+			args: func(*testing.T) args {
+				return args{input: "m"}
+			},
+			want1: searchMode{
+				M: true,
+			},
+		},
+
+		{
+			name: "'q' should include only decoded strings",
+			args: func(*testing.T) args {
+				return args{input: "q"}
+			},
+			want1: searchMode{
+				Q: true,
+			},
+		},
+
+		{
+			name: "'aq' should add decoded strings",
+			args: func(*testing.T) args {
+				return args{input: "aq"}
+			},
+			want1: searchMode{
+				C: true,
+				D: true,
+				E: true,
+				I: true,
+				K: true,
+				N: true,
+				O: true,
+				P: true,
+				Q: true,
+				R: true,
+				S: true,
+				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -615,6 +743,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -623,6 +752,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: false,
 				S: true,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -645,6 +775,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -653,6 +784,7 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: false,
 				T: true,
+				U: true,
 				V: true,
 			},
 		},
@@ -675,6 +807,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -683,6 +816,39 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: false,
+				U: true,
+				V: true,
+			},
+		},
+
+		{
+			name: "'u' should include only code points",
+			args: func(*testing.T) args {
+				return args{input: "u"}
+			},
+			want1: searchMode{
+				U: true,
+			},
+		},
+
+		{
+			name: "'aU' should only exclude code points",
+			args: func(*testing.T) args {
+				return args{input: "aU"}
+			},
+			want1: searchMode{
+				C: true,
+				D: true,
+				E: true,
+				I: true,
+				K: true,
+				N: true,
+				O: true,
+				P: true,
+				R: true,
+				S: true,
+				T: true,
+				U: false,
 				V: true,
 			},
 		},
@@ -705,6 +871,7 @@ func Test_parseFirstArg(t *testing.T) {
 			want1: searchMode{
 				C: true,
 				D: true,
+				E: true,
 				I: true,
 				K: true,
 				N: true,
@@ -713,10 +880,41 @@ func Test_parseFirstArg(t *testing.T) {
 				R: true,
 				S: true,
 				T: true,
+				U: true,
 				V: false,
 			},
 		},
 
+		{
+			name: "'y' should include only doc comments",
+			args: func(*testing.T) args {
+				return args{input: "y"}
+			},
+			want1: searchMode{
+				Y: true,
+			},
+		},
+
+		{
+			name: "'w' should include only comments other than doc comments",
+			args: func(*testing.T) args {
+				return args{input: "w"}
+			},
+			want1: searchMode{
+				W: true,
+			},
+		},
+
+		{
+			name: "'z' should include only imports",
+			args: func(*testing.T) args {
+				return args{input: "z"}
+			},
+			want1: searchMode{
+				Z: true,
+			},
+		},
+
 		{
 			name: "'g' should be grep mode",
 			args: func(*testing.T) args {
@@ -732,7 +930,7 @@ func Test_parseFirstArg(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tArgs := tt.args(t)
 
-			got1 := parseFirstArg(tArgs.input)
+			got1, _ := parseFirstArg(tArgs.input)
 
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("parseFirstArg got1 = %v, want1: %v", got1, tt.want1)
@@ -772,7 +970,7 @@ func Test_setupModeGG(t *testing.T) {
 			args: func(*testing.T) args {
 				return args{args: []string{"v", "11"}}
 			},
-			want1: searchMode{V: true, vInt: 11, vIsInt: true},
+			want1: searchMode{V: true, value: valueQuery{{op: "==", x: number{r: big.NewRat(11, 1)}}}},
 		},
 
 		{
@@ -780,7 +978,7 @@ func Test_setupModeGG(t *testing.T) {
 			args: func(*testing.T) args {
 				return args{args: []string{"v", "-42"}}
 			},
-			want1: searchMode{V: true, vInt: 42, vIsInt: true},
+			want1: searchMode{V: true, value: valueQuery{{op: "==", x: number{r: big.NewRat(-42, 1)}}}},
 		},
 
 		{
@@ -788,7 +986,7 @@ func Test_setupModeGG(t *testing.T) {
 			args: func(*testing.T) args {
 				return args{args: []string{"v", "8.93"}}
 			},
-			want1: searchMode{V: true, vFloat: 8.93, vIsInt: false},
+			want1: searchMode{V: true, value: valueQuery{{op: "==", x: number{r: big.NewRat(893, 100)}}}},
 		},
 
 		{
@@ -796,7 +994,23 @@ func Test_setupModeGG(t *testing.T) {
 			args: func(*testing.T) args {
 				return args{args: []string{"v", "-8.93"}}
 			},
-			want1: searchMode{V: true, vFloat: 8.93, vIsInt: false},
+			want1: searchMode{V: true, value: valueQuery{{op: "==", x: number{r: big.NewRat(-893, 100)}}}},
+		},
+
+		{
+			name: "code point matcher should work for characters",
+			args: func(*testing.T) args {
+				return args{args: []string{"u", "A"}}
+			},
+			want1: searchMode{U: true, codePoint: codePointQuery{{lo: 'A', hi: 'A'}}},
+		},
+
+		{
+			name: "code point matcher should not work for words",
+			args: func(*testing.T) args {
+				return args{args: []string{"u", "asdf"}}
+			},
+			want1: searchMode{},
 		},
 
 		{
@@ -812,7 +1026,7 @@ func Test_setupModeGG(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tArgs := tt.args(t)
 
-			got1 := setupModeGG(tArgs.args)
+			got1, _ := setupModeGG(tArgs.args)
 
 			if !reflect.DeepEqual(got1, tt.want1) {
 				t.Errorf("setupModeGG got1 = %v, want1: %v", got1, tt.want1)
@@ -878,3 +1092,100 @@ func Test_getRegexp(t *testing.T) {
 		})
 	}
 }
+
+func Test_getPattern(t *testing.T) {
+	type args struct {
+		input                   string
+		fixed, word, ignoreCase bool
+	}
+	tests := []struct {
+		name string
+		args args
+
+		want1 string
+	}{
+		{
+			name:  "plain pattern is unchanged",
+			args:  args{input: "fmt.Print(ln)?"},
+			want1: "fmt.Print(ln)?",
+		},
+
+		{
+			name:  "fixed pattern is quoted",
+			args:  args{input: "fmt.Println", fixed: true},
+			want1: `fmt\.Println`,
+		},
+
+		{
+			name:  "all options",
+			args:  args{input: "a|b", fixed: true, word: true, ignoreCase: true},
+			want1: `(?i)\b(?:a\|b)\b`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := getPattern(tt.args.input, tt.args.fixed, tt.args.word, tt.args.ignoreCase)
+
+			if got1 != tt.want1 {
+				t.Errorf("getPattern got1 = %q, want1: %q", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_getLiteral(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		fixed bool
+
+		want1 []byte
+	}{
+		{name: "literal", input: "Println", want1: []byte("Println")},
+		{name: "escaped literal", input: `fmt\.Println`, want1: []byte("fmt.Println")},
+		{name: "fixed string", input: "a.b", fixed: true, want1: []byte("a.b")},
+		{name: "regular expression", input: "Print(ln)?", want1: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := getLiteral(tt.input, tt.fixed)
+
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("getLiteral got1 = %q, want1: %q", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_splitClasses(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+
+		want1 string
+		want2 string
+	}{
+		{name: "no prefix", input: "TODO", want1: "i", want2: "TODO"},
+		{name: "prefix", input: "cs:TODO", want1: "cs", want2: "TODO"},
+		{name: "negative prefix", input: "aC:x", want1: "aC", want2: "x"},
+		{name: "empty prefix", input: ":std:x", want1: "i", want2: "std:x"},
+		{name: "not classes", input: "http://", want1: "i", want2: "http://"},
+		{name: "grep is not a prefix", input: "g:x", want1: "i", want2: "g:x"},
+		{name: "repeated letter", input: "TODO:", want1: "i", want2: "TODO:"},
+		{name: "capitalized word", input: "Deprecated: use", want1: "i", want2: "Deprecated: use"},
+		{name: "repeated class", input: "cC:x", want1: "i", want2: "cC:x"},
+		{name: "upper case first", input: "C:x", want1: "i", want2: "C:x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1, got2 := splitClasses(tt.input, "i")
+
+			if got1 != tt.want1 || got2 != tt.want2 {
+				t.Errorf("splitClasses got = %q, %q, want: %q, %q", got1, got2, tt.want1, tt.want2)
+			}
+		})
+	}
+}
@@ -0,0 +1,532 @@
+/*
+Package search is the engine of gg. It scans Go source files, compressed
+files, and archives of either, passing each through Go-language lexical
+analysis and reporting lines where selected classes of tokens match a
+search pattern defined by a regular expression.
+
+A Searcher is built from Options and reports each scanned file's matches
+to a handler function:
+
+	s, err := search.New(search.Options{Classes: "c", Pattern: "TODO"},
+		func(r *search.Result) {
+			for _, m := range r.Matches {
+				fmt.Printf("%s:%d:%s\n", r.Name, m.Line, m.Text)
+			}
+		})
+	if err != nil {
+		return err
+	}
+	s.File(".")
+	summary := s.Complete()
+
+Files are scanned concurrently but the handler is called from a single
+goroutine, one file at a time.
+*/
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Options configure a Searcher. The zero value, given a pattern, searches
+// nothing; at least one token class or Grep must be selected.
+type Options struct {
+	// Classes selects token classes using the letters of the gg command
+	// line, "acdefikmnopqrstuvwxyzg" in any order or combination, with upper
+	// case letters excluding a class: "aCS" means all tokens except Comments
+	// and Strings. "a" selects c, d, e, i, k, n, o, p, r, s, t, u, and v,
+	// declarations (e) and code points (u) among them, but not the classes
+	// that overlap these: f, m, q, w, x, y, and z.
+	Classes string
+
+	// Pattern is the regular expression to match. For value searches
+	// (class "v") it is also parsed as the number to match.
+	Pattern string
+
+	// Patterns, when not empty, are searched at once in place of Pattern.
+	// Each may begin with token classes and a colon, as in "c:TODO" or
+	// "i:^Deprecated", to search those classes rather than Classes; an
+	// empty prefix, as in ":std:x", keeps Classes. Matches name the pattern
+	// that matched when there are several, and a line matching more than one
+	// is reported once.
+	Patterns []string
+
+	// AST searches the names of Go syntax nodes, as parsed by go/parser,
+	// rather than tokens. It is a comma-separated list of node kinds:
+	// "func" for function names, "method" for method names qualified by
+	// their receiver type as in "Searcher.Scan", "call" for the functions
+	// called as written, "fmt.Println", "type" for type names, "field" for
+	// struct field names, "interface" for interface method names, "label"
+	// for labels, or "all". Files that do not parse are searched by token
+	// in the classes of Classes, identifiers when it is empty. AST is
+	// ignored in grep mode.
+	AST string
+
+	// Semantic searches type checked packages for the object named by
+	// Pattern, a package-level object as in "os.Open" or "io.Reader", or a
+	// method or field of a type, "(*os.File).Close", rather than matching a
+	// regular expression. Packages loads and scans the packages. It is a
+	// comma-separated list of the relations to the object to find: "def"
+	// for its definition, "ref" for references, "call" for calls, "impl"
+	// for the types or methods implementing an interface or interface
+	// method, or "all". Semantic is ignored in grep mode, and Invert,
+	// IgnoreCase, Fixed, and Word do not apply.
+	Semantic string
+
+	// Sequence matches Pattern to runs of adjacent tokens rather than to one
+	// token, ignoring space and comments. Pattern is a list of words, each
+	// matching a token: "classes:regexp" a token of the classes, given as
+	// in Classes, whose whole text the regular expression matches; or "_"
+	// any token. A word may be followed by a repetition, "?", "*", "+",
+	// "{m}", "{m,}", or "{m,n}", that matches as few tokens as it can.
+	// "k:go i: o:\(" finds goroutines started by calling a named function,
+	// and "k:defer k:func o:\( o:\) o:{ _ {0,20} d:recover" deferred
+	// recovery. Classes is not used. Sequence is ignored in grep mode.
+	Sequence bool
+
+	// Grep ignores Go lexical analysis and matches lines as grep does.
+	Grep bool
+
+	// IgnoreCase matches without regard to case, as if Pattern began with
+	// "(?i)".
+	IgnoreCase bool
+
+	// Fixed takes Pattern as a literal string rather than a regular
+	// expression: "fmt.Println" matches only itself.
+	Fixed bool
+
+	// Tolerance widens value searches for a number to the literals near
+	// it: by a distance, "1e-9"; by a percentage of the number, "0.01%";
+	// or by units in the last place of the number as a float64, "4ulp".
+	// A comma-separated list, "1e-9,4ulp", allows the widest of these.
+	// Ranges, comparisons, and other value queries are not widened.
+	Tolerance string
+
+	// Word matches only whole words. Identifiers and keywords match only when
+	// the whole token matches, and when Pattern is literal they are compared
+	// to it directly without the regular expression engine.
+	Word bool
+
+	// Invert reports lines that do not match. In grep mode these are lines
+	// where the pattern is not found; otherwise they are lines that have
+	// tokens of the selected classes but where none of those tokens match.
+	Invert bool
+
+	// Recursive scans directories and all of their subdirectories.
+	Recursive bool
+
+	// AllFiles scans every file rather than only ".go" files.
+	AllFiles bool
+
+	// Hidden scans files and directories with names that start with ".".
+	Hidden bool
+
+	// NoMap reads plain files rather than memory mapping them.
+	NoMap bool
+
+	// Before and After are the number of lines of context to report
+	// before and after each matching line, as with grep's -B and -A.
+	Before int
+	After  int
+
+	// MaxCount, when positive, stops the scan of each file after that many
+	// matching lines. A MaxCount of one is enough to learn which files match.
+	MaxCount int
+
+	// MaxTotal, when positive, ends the search after that many matching
+	// lines in all files. Scans in progress are abandoned, files not yet
+	// scanned are skipped, and directory walks stop, so a search for the
+	// existence of a match finishes at its first.
+	MaxTotal int
+
+	// Ordered reports results in the order files were named rather than
+	// the order in which their scans complete.
+	Ordered bool
+
+	// Workers is the number of concurrent scanners. Zero or less means one
+	// per CPU.
+	Workers int
+
+	// Logf, when not nil, receives a log of execution details.
+	Logf func(format string, v ...interface{})
+}
+
+// Match is a line that contains a matching token. In an inverted search it is
+// a line without one: Token is the line's first token of a selected class
+// (empty in grep mode) and Start equals End since nothing matched.
+type Match struct {
+	Line    int    `json:"line"`              // line number, counting from one
+	Column  int    `json:"column"`            // byte column of the matching token, counting from one
+	Offset  int    `json:"offset"`            // byte offset of the matching token in the file
+	Class   string `json:"class,omitempty"`   // token class: "comment", "identifier", ...
+	Pattern string `json:"pattern,omitempty"` // member of Options.Patterns that matched
+	Subtype int    `json:"subtype"`           // lexer subtype of the matching token
+	Token   string `json:"token"`             // matching token, or its line if it spans lines
+	Text    string `json:"text"`              // text of the line, without the trailing newline
+	Start   int    `json:"start"`             // byte index in Text where the matching text begins
+	End     int    `json:"end"`               // byte index in Text where the matching text ends
+
+	Before []Line `json:"before,omitempty"` // context preceding the line
+	After  []Line `json:"after,omitempty"`  // context following the line
+}
+
+// Line is a line of context near a match. Context lines are not repeated:
+// lines shared by neighboring matches belong to the first of them.
+type Line struct {
+	Line int    `json:"line"` // line number, counting from one
+	Text string `json:"text"` // text of the line, without the trailing newline
+}
+
+// Result is the outcome of scanning one file.
+type Result struct {
+	Name    string  // file name, "archive.tar::file.go" for archive members
+	Matches []Match // matching lines in file order
+	Summary Summary // work done scanning this file
+
+	complete bool // worker has finished (not a file)
+}
+
+// Summary accumulates the work done by a search.
+type Summary struct {
+	Bytes   int `json:"bytes"`
+	Tokens  int `json:"tokens"`
+	Matches int `json:"matches"`
+	Lines   int `json:"lines"`
+	Files   int `json:"files"`
+}
+
+// SplitName separates a result name into the file and, for archive members,
+// the member name: "a.tar::x.go" is file "a.tar" and member "x.go".
+func SplitName(name string) (file, member string) {
+	if i := strings.Index(name, "::"); i >= 0 {
+		return name[:i], name[i+2:]
+	}
+	return name, ""
+}
+
+// Searcher scans files for matching tokens. It is not safe for concurrent
+// use: name files from one goroutine and then call Complete.
+type Searcher struct {
+	opt      Options
+	grep     bool
+	ast      map[string]bool // AST mode's node kinds
+	semantic map[string]bool // semantic mode's relations
+
+	foundLock sync.Mutex
+	found     map[string][]semanticMatch // semantic matches by file name
+	matchers  []*matcher
+	handler   func(*Result)
+
+	first     bool
+	workers   int
+	scattered int
+	work      []chan work
+	result    []chan *Result
+	done      chan Summary
+
+	complete bool
+	total    Summary
+	halt     int32 // search satisfied, accessed atomically
+}
+
+type work struct {
+	name   string
+	source []byte
+}
+
+// New returns a Searcher for the given options that calls handler with the
+// result of each file scanned. A nil handler discards results, leaving only
+// the Summary returned by Complete.
+func New(opt Options, handler func(*Result)) (*Searcher, error) {
+	if opt.AST != "" && opt.Classes == "" {
+		opt.Classes = "i" // for files that do not parse
+	}
+	s := &Searcher{opt: opt, handler: handler, first: true}
+
+	// grep mode, by option or by class "g", searches lines and not tokens
+	s.grep = opt.Grep
+	if !s.grep {
+		mode, err := parseFirstArg(opt.Classes)
+		if err != nil {
+			return nil, err
+		}
+		s.grep = mode.G
+	}
+
+	if !s.grep {
+		kinds, err := parseKinds(opt.AST, "syntax node kind", astKinds)
+		if err != nil {
+			return nil, err
+		}
+		s.ast = kinds
+		s.semantic, err = parseKinds(opt.Semantic, "semantic relation", semanticKinds)
+		if err != nil {
+			return nil, err
+		}
+		if s.semantic != nil {
+			s.found = map[string][]semanticMatch{}
+		}
+	}
+
+	tol, err := parseTolerance(opt.Tolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := opt.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{opt.Pattern}
+	}
+	for _, input := range patterns {
+		classes, pattern := opt.Classes, input
+		if !s.grep && len(opt.Patterns) > 0 {
+			classes, pattern = splitClasses(input, opt.Classes) // "-e c:TODO"
+		}
+		m := &matcher{}
+		if len(opt.Patterns) > 1 {
+			m.pattern = input
+		}
+		if s.semantic != nil {
+			m.object = input // found by Packages
+			s.matchers = append(s.matchers, m)
+			continue
+		}
+		if opt.Sequence && !s.grep {
+			m.sequence, err = parseSequence(input, opt.Fixed, opt.IgnoreCase)
+			if err != nil {
+				return nil, err
+			}
+			s.matchers = append(s.matchers, m)
+			continue
+		}
+
+		// gg mode
+		var err error
+		if !s.grep {
+			m.mode, err = setupModeGG([]string{classes, pattern})
+			if v, ok := err.(*valueError); ok {
+				s.printf("value search disabled: %v", v) // "gg a name" is not a number
+			} else if err != nil {
+				return nil, err
+			}
+			m.mode.value = m.mode.value.widen(tol)
+		}
+
+		// initialize regular expression matcher
+		m.regex, err = getRegexp(getPattern(pattern, opt.Fixed, opt.Word, opt.IgnoreCase))
+		if err != nil && m.mode.valueOnly() {
+			m.regex, err = getRegexp(regexp.QuoteMeta(pattern)) // "{8080,8443}" is a query, not a regexp
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opt.Word {
+			m.literal = getLiteral(pattern, opt.Fixed)
+			if m.literal == nil && !m.mode.valueOnly() {
+				// the whole token, not a part between ASCII word boundaries
+				m.token, err = getRegexp(`^(?:` + getPattern(pattern, opt.Fixed, false, opt.IgnoreCase) + `)$`)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if m.mode.F {
+			var value string
+			m.tagKey, value = splitTagQuery(pattern) // "json:omitempty"
+			m.tagRegex, err = getRegexp(getPattern(value, opt.Fixed, opt.Word, opt.IgnoreCase))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if m.mode.M {
+			name, args := splitDirectiveQuery(pattern) // "go:linkname runtime\."
+			if name != "" {
+				m.directiveName, err = getRegexp(`^(?:` + getPattern(name, opt.Fixed, false, opt.IgnoreCase) + `)$`)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if args != "" {
+				m.directiveArgs, err = getRegexp(getPattern(args, opt.Fixed, opt.Word, opt.IgnoreCase))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if m.mode.Z {
+			alias, path := splitImportQuery(pattern) // "_ ."
+			if alias != "" {
+				m.importAlias, err = getRegexp(`^(?:` + getPattern(alias, opt.Fixed, false, opt.IgnoreCase) + `)$`)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if !opt.Fixed {
+				path = importPattern(path) // "golang.org/x/tools/..."
+			}
+			m.importPath, err = getRegexp(getPattern(path, opt.Fixed, opt.Word, opt.IgnoreCase))
+			if err != nil {
+				return nil, err
+			}
+		}
+		c := &m.mode
+		m.dispatch = []*bool{nil, nil, &c.C, &c.I, &c.K, &c.O, &c.R, nil, &c.S, &c.T, &c.D, &c.N, nil}
+		s.matchers = append(s.matchers, m)
+	}
+
+	s.workers = opt.Workers
+	if s.workers <= 0 {
+		s.workers = runtime.NumCPU()
+	}
+	return s, nil
+}
+
+func (s *Searcher) worker(wIn chan work, sOut chan *Result) {
+	matchers := make([]*matcher, len(s.matchers))
+	for i, m := range s.matchers {
+		matchers[i] = m.copy()
+	}
+	for w := range wIn {
+		if s.stopped() {
+			sOut <- &Result{Name: w.name} // drain: reporter discards it
+			continue
+		}
+		sOut <- s.scan(matchers, w.name, w.source)
+	}
+	sOut <- &Result{complete: true} // signal that this worker is done
+}
+
+// Scan schedules the named source for scanning. When source is nil the
+// named file is read (and decompressed if needed); otherwise source is the
+// possibly compressed content of the named file, such as an archive member.
+func (s *Searcher) Scan(name string, source []byte) {
+	if s.first {
+		switch s.opt.Ordered {
+		case false:
+			const workQueue = 1024
+			s.work = make([]chan work, 1)
+			s.result = make([]chan *Result, 1)
+			s.work[0] = make(chan work, workQueue)
+			s.result[0] = make(chan *Result, workQueue)
+			for i := 0; i < s.workers; i++ {
+				go s.worker(s.work[0], s.result[0])
+			}
+		case true:
+			s.work = make([]chan work, s.workers)
+			s.result = make([]chan *Result, s.workers)
+			for i := 0; i < s.workers; i++ {
+				const balanceQueue = 512
+				s.work[i] = make(chan work, balanceQueue)
+				s.result[i] = make(chan *Result, balanceQueue)
+				go s.worker(s.work[i], s.result[i])
+			}
+		}
+		s.done = make(chan Summary)
+		go s.reporter() // wait for and gather results
+		s.first = false
+	}
+
+	switch {
+	case name == "": // end of scan
+		for i := range s.work {
+			close(s.work[i]) // signal completion to workers
+		}
+	case s.stopped(): // search satisfied
+		return
+	default: // another file to scan
+		s.work[s.scattered%len(s.work)] <- work{name: name, source: source} // enqueue scan request
+		s.scattered++
+	}
+}
+
+// Complete waits for all scheduled scans to finish and their results to be
+// reported, then returns the accumulated Summary.
+func (s *Searcher) Complete() Summary {
+	if !s.complete {
+		s.Scan("", nil)    // Signal end of additional files...
+		s.total = <-s.done // ...and await completion.of scanning & reporting
+		for i := range s.result {
+			close(s.result[i])
+		}
+		s.complete = true // Record completion
+	}
+	return s.total
+}
+
+func (s *Searcher) reporter() {
+	// summary statistics
+	total := Summary{}
+
+	// report results per file
+	gathered := 0
+	completed := 0
+	reported := 0 // matches passed to handler
+	for {
+		// get next result in search order
+		r := <-s.result[gathered%len(s.result)]
+		gathered++
+
+		// handle completion events
+		if r.complete {
+			completed++ // one more worker has finished
+			if completed == s.workers {
+				break // all workers have now finished
+			}
+			continue
+		}
+
+		// discard scans in flight once the search is satisfied
+		if s.stopped() {
+			continue
+		}
+		if s.opt.MaxTotal > 0 {
+			if left := s.opt.MaxTotal - reported; len(r.Matches) >= left {
+				r.Matches = r.Matches[:left]
+				s.stop() // this file completes the search
+			}
+			reported += len(r.Matches)
+		}
+
+		// report all matching lines in file
+		if s.handler != nil {
+			s.handler(r)
+		}
+
+		total.Bytes += r.Summary.Bytes
+		total.Tokens += r.Summary.Tokens
+		total.Matches += r.Summary.Matches
+		total.Lines += r.Summary.Lines
+		total.Files++
+	}
+
+	// signal completion to main program
+	s.done <- total // scanning complete, here are totals
+}
+
+// stop ends the search: workers drain their queues without scanning and
+// no further files are scheduled
+func (s *Searcher) stop() {
+	atomic.StoreInt32(&s.halt, 1)
+}
+
+// stopped reports whether the search has ended early
+func (s *Searcher) stopped() bool {
+	return atomic.LoadInt32(&s.halt) != 0
+}
+
+func (s *Searcher) println(v ...interface{}) {
+	if s.opt.Logf != nil {
+		s.opt.Logf("%s", fmt.Sprintln(v...))
+	}
+}
+
+func (s *Searcher) printf(f string, v ...interface{}) {
+	if s.opt.Logf != nil {
+		s.opt.Logf(f, v...)
+	}
+}
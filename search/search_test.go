@@ -0,0 +1,1030 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = `package sample // comment on line 1
+
+// Fetch returns 255 bytes
+func Fetch() int {
+	return 0xff // fetch it
+}
+
+var doc = ` + "`first line\n\tsecond fetch line`\n"
+
+func searchSample(t *testing.T, opt Options) []Match {
+	return searchSource(t, opt, sample)
+}
+
+func searchSource(t *testing.T, opt Options, source string) []Match {
+	var matches []Match
+	s, err := New(opt, func(r *Result) {
+		for _, m := range r.Matches {
+			m.Subtype = 0 // subtype codes belong to package lex
+			matches = append(matches, m)
+		}
+	})
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+	s.Scan("sample.go", []byte(source))
+	s.Complete()
+	return matches
+}
+
+// countMatches returns the number of matches a search counts in source, on
+// which its exit status depends
+func countMatches(t *testing.T, opt Options, source string) int {
+	s, err := New(opt, nil)
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+	s.Scan("sample.go", []byte(source))
+	return s.Complete().Matches
+}
+
+func TestSearcher(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "comments",
+			opt:  Options{Classes: "c", Pattern: "(?i)fetch"},
+			want1: []Match{
+				{Line: 3, Column: 1, Offset: 37, Class: "comment", Token: "// Fetch returns 255 bytes", Text: "// Fetch returns 255 bytes", Start: 3, End: 8},
+				{Line: 5, Column: 14, Offset: 96, Class: "comment", Token: "// fetch it", Text: "\treturn 0xff // fetch it", Start: 16, End: 21},
+			},
+		},
+
+		{
+			name: "identifiers",
+			opt:  Options{Classes: "i", Pattern: "Fetch"},
+			want1: []Match{
+				{Line: 4, Column: 6, Offset: 69, Class: "identifier", Token: "Fetch", Text: "func Fetch() int {", Start: 5, End: 10},
+			},
+		},
+
+		{
+			name: "values",
+			opt:  Options{Classes: "v", Pattern: "255"},
+			want1: []Match{
+				{Line: 5, Column: 9, Offset: 91, Class: "value", Token: "0xff", Text: "\treturn 0xff // fetch it", Start: 8, End: 12},
+			},
+		},
+
+		{
+			name: "value range",
+			opt:  Options{Classes: "v", Pattern: "200..300"},
+			want1: []Match{
+				{Line: 5, Column: 9, Offset: 91, Class: "value", Token: "0xff", Text: "\treturn 0xff // fetch it", Start: 8, End: 12},
+			},
+		},
+
+		{
+			name: "value set",
+			opt:  Options{Classes: "v", Pattern: "{0,255}"},
+			want1: []Match{
+				{Line: 5, Column: 9, Offset: 91, Class: "value", Token: "0xff", Text: "\treturn 0xff // fetch it", Start: 8, End: 12},
+			},
+		},
+
+		{
+			name: "value tolerance",
+			opt:  Options{Classes: "v", Pattern: "250", Tolerance: "2%"},
+			want1: []Match{
+				{Line: 5, Column: 9, Offset: 91, Class: "value", Token: "0xff", Text: "\treturn 0xff // fetch it", Start: 8, End: 12},
+			},
+		},
+
+		{
+			name: "decoded raw string lines",
+			opt:  Options{Classes: "q", Pattern: "^(first|\tsecond)"},
+			want1: []Match{
+				{Line: 8, Column: 12, Offset: 122, Class: "decoded", Token: "first line", Text: "var doc = `first line", Start: 11, End: 16},
+				{Line: 9, Column: 1, Offset: 133, Class: "decoded", Token: "\tsecond fetch line", Text: "\tsecond fetch line`", Start: 0, End: 7},
+			},
+		},
+
+		{
+			name: "grep",
+			opt:  Options{Grep: true, Pattern: "255"},
+			want1: []Match{
+				{Line: 3, Column: 18, Offset: 54, Token: "255", Text: "// Fetch returns 255 bytes", Start: 17, End: 20},
+			},
+		},
+
+		{
+			name: "package",
+			opt:  Options{Classes: "p", Pattern: "sample"},
+			want1: []Match{
+				{Line: 1, Column: 9, Offset: 8, Class: "package", Token: "sample", Text: "package sample // comment on line 1", Start: 8, End: 14},
+			},
+		},
+
+		{
+			name: "context",
+			opt:  Options{Classes: "c", Pattern: "(?i)fetch", Before: 1, After: 1},
+			want1: []Match{
+				{Line: 3, Column: 1, Offset: 37, Class: "comment", Token: "// Fetch returns 255 bytes", Text: "// Fetch returns 255 bytes", Start: 3, End: 8,
+					Before: []Line{{Line: 2, Text: ""}},
+					After:  []Line{{Line: 4, Text: "func Fetch() int {"}}},
+				{Line: 5, Column: 14, Offset: 96, Class: "comment", Token: "// fetch it", Text: "\treturn 0xff // fetch it", Start: 16, End: 21,
+					After: []Line{{Line: 6, Text: "}"}}},
+			},
+		},
+
+		{
+			name: "max count",
+			opt:  Options{Classes: "c", Pattern: "(?i)fetch", MaxCount: 1},
+			want1: []Match{
+				{Line: 3, Column: 1, Offset: 37, Class: "comment", Token: "// Fetch returns 255 bytes", Text: "// Fetch returns 255 bytes", Start: 3, End: 8},
+			},
+		},
+
+		{
+			name: "max total",
+			opt:  Options{Classes: "ci", Pattern: "(?i)fetch", MaxTotal: 2},
+			want1: []Match{
+				{Line: 3, Column: 1, Offset: 37, Class: "comment", Token: "// Fetch returns 255 bytes", Text: "// Fetch returns 255 bytes", Start: 3, End: 8},
+				{Line: 4, Column: 6, Offset: 69, Class: "identifier", Token: "Fetch", Text: "func Fetch() int {", Start: 5, End: 10},
+			},
+		},
+
+		{
+			name: "ignore case",
+			opt:  Options{Classes: "i", Pattern: "fetch", IgnoreCase: true},
+			want1: []Match{
+				{Line: 4, Column: 6, Offset: 69, Class: "identifier", Token: "Fetch", Text: "func Fetch() int {", Start: 5, End: 10},
+			},
+		},
+
+		{
+			name: "fixed string",
+			opt:  Options{Grep: true, Pattern: "Fetch()", Fixed: true},
+			want1: []Match{
+				{Line: 4, Column: 6, Offset: 69, Token: "Fetch()", Text: "func Fetch() int {", Start: 5, End: 12},
+			},
+		},
+
+		{
+			name: "whole word in comments",
+			opt:  Options{Classes: "c", Pattern: "fetch", Word: true},
+			want1: []Match{
+				{Line: 5, Column: 14, Offset: 96, Class: "comment", Token: "// fetch it", Text: "\treturn 0xff // fetch it", Start: 16, End: 21},
+			},
+		},
+
+		{
+			name: "whole identifier",
+			opt:  Options{Classes: "i", Pattern: "fetch", Word: true, IgnoreCase: true},
+			want1: []Match{
+				{Line: 4, Column: 6, Offset: 69, Class: "identifier", Token: "Fetch", Text: "func Fetch() int {", Start: 5, End: 10},
+			},
+		},
+
+		{
+			name: "partial identifier",
+			opt:  Options{Classes: "i", Pattern: "Fetc", Word: true},
+		},
+
+		{
+			name: "inverted grep",
+			opt:  Options{Grep: true, Pattern: "e", Invert: true},
+			want1: []Match{
+				{Line: 2, Column: 1, Offset: 36, Text: ""},
+				{Line: 6, Column: 1, Offset: 108, Text: "}"},
+				{Line: 7, Column: 1, Offset: 110, Text: ""},
+			},
+		},
+
+		{
+			name: "inverted comments",
+			opt:  Options{Classes: "c", Pattern: "fetch", Invert: true},
+			want1: []Match{
+				{Line: 1, Column: 16, Offset: 15, Class: "comment", Token: "// comment on line 1", Text: "package sample // comment on line 1", Start: 15, End: 15},
+				{Line: 3, Column: 1, Offset: 37, Class: "comment", Token: "// Fetch returns 255 bytes", Text: "// Fetch returns 255 bytes", Start: 0, End: 0},
+			},
+		},
+
+		{
+			name: "inverted comments with max count",
+			opt:  Options{Classes: "c", Pattern: "fetch", Invert: true, MaxCount: 1},
+			want1: []Match{
+				{Line: 1, Column: 16, Offset: 15, Class: "comment", Token: "// comment on line 1", Text: "package sample // comment on line 1", Start: 15, End: 15},
+			},
+		},
+
+		{
+			name: "inverted values",
+			opt:  Options{Classes: "v", Pattern: "0", Invert: true},
+			want1: []Match{
+				{Line: 5, Column: 9, Offset: 91, Class: "value", Token: "0xff", Text: "\treturn 0xff // fetch it", Start: 8, End: 8},
+			},
+		},
+
+		{
+			name: "patterns",
+			opt:  Options{Classes: "i", Patterns: []string{"c:fetch", "Fetch", "s:second", "k:return"}},
+			want1: []Match{
+				{Line: 4, Column: 6, Offset: 69, Class: "identifier", Pattern: "Fetch", Token: "Fetch", Text: "func Fetch() int {", Start: 5, End: 10},
+				{Line: 5, Column: 2, Offset: 84, Class: "keyword", Pattern: "k:return", Token: "return", Text: "\treturn 0xff // fetch it", Start: 1, End: 7},
+				{Line: 9, Column: 2, Offset: 134, Class: "string", Pattern: "s:second", Token: "\tsecond fetch line`", Text: "\tsecond fetch line`", Start: 1, End: 7},
+			},
+		},
+
+		{
+			name: "raw string line",
+			opt:  Options{Classes: "s", Pattern: "fetch"},
+			want1: []Match{
+				{Line: 9, Column: 9, Offset: 141, Class: "string", Token: "\tsecond fetch line`", Text: "\tsecond fetch line`", Start: 8, End: 13},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSample(t, tt.opt)
+
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("Searcher got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const words = `package words
+
+var Getä = 1
+var Gut = 2
+`
+
+func TestWholeTokens(t *testing.T) {
+	// "G.t" matches "Get" in "Getä" between ASCII word boundaries
+	got1 := searchSource(t, Options{Classes: "i", Pattern: "G.t", Word: true}, words)
+	want1 := []Match{
+		{Line: 4, Column: 5, Offset: 33, Class: "identifier", Token: "Gut", Text: "var Gut = 2", Start: 4, End: 7},
+	}
+	if !reflect.DeepEqual(got1, want1) {
+		t.Errorf("whole tokens got1 = %v, want1: %v", got1, want1)
+	}
+}
+
+const negatives = `package negatives
+
+var a = -1
+var b = n-1
+func f() int { return -0x1 }
+var c = []int{2 - 1, - 1}
+var d = f()-1
+`
+
+func TestNegativeValues(t *testing.T) {
+	got1 := searchSource(t, Options{Classes: "v", Pattern: "-1"}, negatives)
+	want1 := []Match{
+		{Line: 3, Column: 9, Offset: 27, Class: "value", Token: "-1", Text: "var a = -1", Start: 8, End: 10},
+		{Line: 5, Column: 23, Offset: 64, Class: "value", Token: "-0x1", Text: "func f() int { return -0x1 }", Start: 22, End: 26},
+		{Line: 6, Column: 22, Offset: 92, Class: "value", Token: "- 1", Text: "var c = []int{2 - 1, - 1}", Start: 21, End: 24},
+	}
+	if !reflect.DeepEqual(got1, want1) {
+		t.Errorf("negative values got1 = %v, want1: %v", got1, want1)
+	}
+	if got2 := countMatches(t, Options{Classes: "v", Pattern: "-1"}, negatives); got2 != 3 {
+		t.Errorf("negative values counted %d matches, want 3", got2)
+	}
+}
+
+const runes = `package runes
+
+var a = []rune{'b', '\x41'}
+var b = '\101'
+var c = 'Ж'
+var d = "A"
+`
+
+func TestCodePoints(t *testing.T) {
+	got1 := searchSource(t, Options{Classes: "u", Pattern: `{A, \p{Cyrillic}}`}, runes)
+	want1 := []Match{
+		{Line: 3, Column: 21, Offset: 35, Class: "code point", Token: `'\x41'`, Text: `var a = []rune{'b', '\x41'}`, Start: 20, End: 26},
+		{Line: 4, Column: 9, Offset: 51, Class: "code point", Token: `'\101'`, Text: `var b = '\101'`, Start: 8, End: 14},
+		{Line: 5, Column: 9, Offset: 66, Class: "code point", Token: "'Ж'", Text: "var c = 'Ж'", Start: 8, End: 12},
+	}
+	if !reflect.DeepEqual(got1, want1) {
+		t.Errorf("code points got1 = %v, want1: %v", got1, want1)
+	}
+	if got2 := countMatches(t, Options{Classes: "u", Pattern: `{A, \p{Cyrillic}}`}, runes); got2 != 3 {
+		t.Errorf("code points counted %d matches, want 3", got2)
+	}
+}
+
+const escapes = `package escapes
+
+var a = "\x41BC"
+var b = "caf\u00e9"
+var c = "ABC"
+var d = "xABC"
+`
+
+func TestDecodedStrings(t *testing.T) {
+	got1 := searchSource(t, Options{Classes: "q", Pattern: "^(ABC|café)$"}, escapes)
+	want1 := []Match{
+		{Line: 3, Column: 10, Offset: 26, Class: "decoded", Token: "ABC", Text: `var a = "\x41BC"`, Start: 9, End: 15},
+		{Line: 4, Column: 10, Offset: 43, Class: "decoded", Token: "café", Text: `var b = "caf\u00e9"`, Start: 9, End: 18},
+		{Line: 5, Column: 10, Offset: 63, Class: "decoded", Token: "ABC", Text: `var c = "ABC"`, Start: 9, End: 12},
+	}
+	if !reflect.DeepEqual(got1, want1) {
+		t.Errorf("decoded strings got1 = %v, want1: %v", got1, want1)
+	}
+}
+
+// tags is Go source with "#" for each backquote
+const tags = `package tags
+
+type User struct {
+	ID   int    #json:"id" db:"user_id"#
+	Name string #json:"name,omitempty"#
+	Note string "json:\"note,omitempty\""
+	Sub  struct {
+		Key [len("json:x")]byte #json:"key,omitempty"#
+	}
+}
+
+var s = "json:\"x,omitempty\""
+
+type Request struct {
+	Port int    #env:"PORT"#
+	Q    string #query:"q" form:"q"#
+}
+`
+
+func TestStructTags(t *testing.T) {
+	bq := func(s string) string { return strings.ReplaceAll(s, "#", "`") }
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "key and value",
+			opt:  Options{Classes: "f", Pattern: "json:omitempty"},
+			want1: []Match{
+				{Line: 5, Column: 14, Offset: 84, Class: "tag", Token: bq(`#json:"name,omitempty"#`), Text: bq("\tName string #json:\"name,omitempty\"#"), Start: 19, End: 35},
+				{Line: 6, Column: 14, Offset: 121, Class: "tag", Token: `"json:\"note,omitempty\""`, Text: `	Note string "json:\"note,omitempty\""`, Start: 19, End: 37},
+				{Line: 8, Column: 27, Offset: 188, Class: "tag", Token: bq(`#json:"key,omitempty"#`), Text: bq(`		Key [len("json:x")]byte #json:"key,omitempty"#`), Start: 32, End: 47},
+			},
+		},
+
+		{
+			name: "anchored value",
+			opt:  Options{Classes: "f", Pattern: "db:^user_"},
+			want1: []Match{
+				{Line: 4, Column: 14, Offset: 46, Class: "tag", Token: bq(`#json:"id" db:"user_id"#`), Text: bq(`	ID   int    #json:"id" db:"user_id"#`), Start: 27, End: 36},
+			},
+		},
+
+		{
+			name: "whole tag",
+			opt:  Options{Classes: "f", Pattern: "^db"},
+		},
+
+		{
+			name: "key of class letters",
+			opt:  Options{Classes: "f", Pattern: "env:PORT"},
+			want1: []Match{
+				{Line: 15, Column: 14, Offset: 284, Class: "tag", Token: bq(`#env:"PORT"#`), Text: bq("\tPort int    #env:\"PORT\"#"), Start: 18, End: 24},
+			},
+		},
+
+		{
+			name: "query key",
+			opt:  Options{Classes: "f", Pattern: "query:^q$"},
+			want1: []Match{
+				{Line: 16, Column: 14, Offset: 310, Class: "tag", Token: bq(`#query:"q" form:"q"#`), Text: bq("\tQ    string #query:\"q\" form:\"q\"#"), Start: 20, End: 23},
+			},
+		},
+
+		{
+			name: "form key",
+			opt:  Options{Classes: "f", Pattern: "form:q"},
+			want1: []Match{
+				{Line: 16, Column: 14, Offset: 310, Class: "tag", Token: bq(`#query:"q" form:"q"#`), Text: bq("\tQ    string #query:\"q\" form:\"q\"#"), Start: 29, End: 32},
+			},
+		},
+
+		{
+			name: "key of class letters after a prefix",
+			opt:  Options{Classes: "i", Patterns: []string{"f:env:PORT"}},
+			want1: []Match{
+				{Line: 15, Column: 14, Offset: 284, Class: "tag", Token: bq(`#env:"PORT"#`), Text: bq("\tPort int    #env:\"PORT\"#"), Start: 18, End: 24},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, bq(tags))
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("struct tags got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const directives = `//go:build linux
+
+// Package directives mentions //go:linkname in prose.
+package directives
+
+/*
+#cgo LDFLAGS: -lm
+*/
+import "C"
+
+//go:linkname now runtime.nanotime
+func now() int64
+
+//go:embed static/*
+var static string
+`
+
+func TestDirectives(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "name",
+			opt:  Options{Classes: "m", Pattern: "go:linkname"},
+			want1: []Match{
+				{Line: 11, Column: 3, Offset: 131, Class: "directive", Token: "//go:linkname now runtime.nanotime", Text: "//go:linkname now runtime.nanotime", Start: 2, End: 13},
+			},
+		},
+
+		{
+			name: "name and arguments",
+			opt:  Options{Classes: "m", Pattern: "go:.* ^static"},
+			want1: []Match{
+				{Line: 14, Column: 12, Offset: 193, Class: "directive", Token: "//go:embed static/*", Text: "//go:embed static/*", Start: 11, End: 17},
+			},
+		},
+
+		{
+			name: "block comment",
+			opt:  Options{Classes: "m", Pattern: "#cgo LDFLAGS"},
+			want1: []Match{
+				{Line: 7, Column: 6, Offset: 101, Class: "directive", Token: "#cgo LDFLAGS: -lm", Text: "#cgo LDFLAGS: -lm", Start: 5, End: 12},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, directives)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("directives got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const docs = `// Package docs is documented.
+package docs
+
+// Deprecated: use G.
+func F() {
+	// Deprecated code follows
+	var x int // Deprecated too
+	_ = x
+}
+
+// Deprecated: not a doc comment
+
+func G() {}
+`
+
+func TestDocComments(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "doc",
+			opt:  Options{Classes: "y", Pattern: "Deprecated"},
+			want1: []Match{
+				{Line: 4, Column: 1, Offset: 45, Class: "doc comment", Token: "// Deprecated: use G.", Text: "// Deprecated: use G.", Start: 3, End: 13},
+				{Line: 6, Column: 2, Offset: 79, Class: "doc comment", Token: "// Deprecated code follows", Text: "\t// Deprecated code follows", Start: 4, End: 14},
+			},
+		},
+
+		{
+			name: "not doc",
+			opt:  Options{Classes: "w", Pattern: "Deprecated"},
+			want1: []Match{
+				{Line: 7, Column: 12, Offset: 117, Class: "comment", Token: "// Deprecated too", Text: "\tvar x int // Deprecated too", Start: 14, End: 24},
+				{Line: 11, Column: 1, Offset: 145, Class: "comment", Token: "// Deprecated: not a doc comment", Text: "// Deprecated: not a doc comment", Start: 3, End: 13},
+			},
+		},
+
+		{
+			name: "deprecation notice",
+			opt:  Options{Classes: "y", Pattern: "Deprecated:"}, // as documented
+			want1: []Match{
+				{Line: 4, Column: 1, Offset: 45, Class: "doc comment", Token: "// Deprecated: use G.", Text: "// Deprecated: use G.", Start: 3, End: 14},
+			},
+		},
+
+		{
+			name: "deprecation notice by -e",
+			opt:  Options{Classes: "y", Patterns: []string{"Deprecated:"}},
+			want1: []Match{
+				{Line: 4, Column: 1, Offset: 45, Class: "doc comment", Token: "// Deprecated: use G.", Text: "// Deprecated: use G.", Start: 3, End: 14},
+			},
+		},
+
+		{
+			name: "package doc",
+			opt:  Options{Classes: "y", Pattern: "Package"},
+			want1: []Match{
+				{Line: 1, Column: 1, Offset: 0, Class: "doc comment", Token: "// Package docs is documented.", Text: "// Package docs is documented.", Start: 3, End: 10},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, docs)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("doc comments got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const imports = `package imports
+
+import "unsafe"
+
+import (
+	"fmt"
+	_ "embed"
+	str "strings"
+	. "golang.org/x/tools/go/packages"
+)
+
+var s = "unsafe"
+`
+
+func TestImports(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "path",
+			opt:  Options{Classes: "z", Pattern: "^unsafe$"},
+			want1: []Match{
+				{Line: 3, Column: 8, Offset: 24, Class: "import", Token: "unsafe", Text: `import "unsafe"`, Start: 8, End: 14},
+			},
+		},
+
+		{
+			name: "alias",
+			opt:  Options{Classes: "z", Pattern: "_ ."},
+			want1: []Match{
+				{Line: 7, Column: 4, Offset: 53, Class: "import", Token: "embed", Text: "\t_ \"embed\"", Start: 4, End: 5},
+			},
+		},
+
+		{
+			name: "named alias",
+			opt:  Options{Classes: "z", Pattern: "str|\\. .*"},
+			want1: []Match{
+				{Line: 8, Column: 6, Offset: 66, Class: "import", Token: "strings", Text: "\tstr \"strings\"", Start: 6, End: 13},
+				{Line: 9, Column: 4, Offset: 79, Class: "import", Token: "golang.org/x/tools/go/packages", Text: "\t. \"golang.org/x/tools/go/packages\"", Start: 4, End: 34},
+			},
+		},
+
+		{
+			name: "module",
+			opt:  Options{Classes: "z", Pattern: "golang.org/x/tools/..."},
+			want1: []Match{
+				{Line: 9, Column: 4, Offset: 79, Class: "import", Token: "golang.org/x/tools/go/packages", Text: "\t. \"golang.org/x/tools/go/packages\"", Start: 4, End: 34},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, imports)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("imports got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const syntax = `package syntax
+
+type List[T any] struct {
+	items []T
+	*sync.Mutex
+}
+
+type Sizer interface {
+	Size() int
+}
+
+func (l *List[T]) Size() int { return len(l.items) }
+
+func Size(s Sizer) int {
+outer:
+	for {
+		break outer
+	}
+	return s.Size()
+}
+`
+
+func TestAST(t *testing.T) {
+	tests := []struct {
+		name   string
+		opt    Options
+		source string
+
+		want1 []Match
+	}{
+		{
+			name:   "method",
+			opt:    Options{AST: "method", Pattern: "^List\\.Size$"},
+			source: syntax,
+			want1: []Match{
+				{Line: 12, Column: 19, Offset: 125, Class: "method", Token: "List.Size", Text: "func (l *List[T]) Size() int { return len(l.items) }", Start: 18, End: 22},
+			},
+		},
+
+		{
+			name:   "func",
+			opt:    Options{AST: "func", Pattern: "Size"},
+			source: syntax,
+			want1: []Match{
+				{Line: 14, Column: 6, Offset: 166, Class: "func", Token: "Size", Text: "func Size(s Sizer) int {", Start: 5, End: 9},
+			},
+		},
+
+		{
+			name:   "call",
+			opt:    Options{AST: "call", Pattern: "Size|len"},
+			source: syntax,
+			want1: []Match{
+				{Line: 12, Column: 39, Offset: 145, Class: "call", Token: "len", Text: "func (l *List[T]) Size() int { return len(l.items) }", Start: 38, End: 41},
+				{Line: 19, Column: 9, Offset: 225, Class: "call", Token: "s.Size", Text: "\treturn s.Size()", Start: 10, End: 14},
+			},
+		},
+
+		{
+			name:   "type and interface",
+			opt:    Options{AST: "type,interface", Pattern: "Size"},
+			source: syntax,
+			want1: []Match{
+				{Line: 8, Column: 6, Offset: 74, Class: "type", Token: "Sizer", Text: "type Sizer interface {", Start: 5, End: 9},
+				{Line: 9, Column: 2, Offset: 93, Class: "interface", Token: "Size", Text: "\tSize() int", Start: 1, End: 5},
+			},
+		},
+
+		{
+			name:   "field",
+			opt:    Options{AST: "field", Pattern: "items|Mutex"},
+			source: syntax,
+			want1: []Match{
+				{Line: 4, Column: 2, Offset: 43, Class: "field", Token: "items", Text: "\titems []T", Start: 1, End: 6},
+				{Line: 5, Column: 2, Offset: 54, Class: "field", Token: "*sync.Mutex", Text: "\t*sync.Mutex", Start: 7, End: 12},
+			},
+		},
+
+		{
+			name:   "label",
+			opt:    Options{AST: "all", Pattern: "outer"},
+			source: syntax,
+			want1: []Match{
+				{Line: 15, Column: 1, Offset: 186, Class: "label", Token: "outer", Text: "outer:", Start: 0, End: 5},
+			},
+		},
+
+		{
+			name:   "inverted with max count",
+			opt:    Options{AST: "type", Pattern: "^Vector", Invert: true, MaxCount: 1},
+			source: syntax,
+			want1: []Match{
+				{Line: 3, Column: 6, Offset: 21, Class: "type", Token: "List", Text: "type List[T any] struct {", Start: 5, End: 5},
+			},
+		},
+
+		{
+			name:   "unparsable",
+			opt:    Options{AST: "func", Pattern: "Size"},
+			source: "package broken\n\nfunc Size( {\n",
+			want1: []Match{
+				{Line: 3, Column: 6, Offset: 21, Class: "identifier", Token: "Size", Text: "func Size( {", Start: 5, End: 9},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, tt.source)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("AST got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func TestDeclarations(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "declared",
+			opt:  Options{Classes: "e", Pattern: "^(Size|l)$"},
+			want1: []Match{
+				{Line: 9, Column: 2, Offset: 93, Class: "identifier", Token: "Size", Text: "\tSize() int", Start: 1, End: 5},
+				{Line: 12, Column: 7, Offset: 113, Class: "identifier", Token: "l", Text: "func (l *List[T]) Size() int { return len(l.items) }", Start: 6, End: 7},
+				{Line: 14, Column: 6, Offset: 166, Class: "identifier", Token: "Size", Text: "func Size(s Sizer) int {", Start: 5, End: 9},
+			},
+		},
+
+		{
+			name: "used",
+			opt:  Options{Classes: "iE", Pattern: "^(Size|l)$"},
+			want1: []Match{
+				{Line: 12, Column: 43, Offset: 149, Class: "identifier", Token: "l", Text: "func (l *List[T]) Size() int { return len(l.items) }", Start: 42, End: 43},
+				{Line: 19, Column: 11, Offset: 227, Class: "identifier", Token: "Size", Text: "\treturn s.Size()", Start: 10, End: 14},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, syntax)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("declarations got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const selectors = `package selectors
+
+import (
+	h "net/http"
+	"fmt"
+	"gopkg.in/yaml.v3"
+)
+
+func get(c *h.Client) {
+	h.Get("x") // not http.Get in a comment
+	s := "or h.Get in a string"
+	c.Get(s)
+	fmt.Println(yaml.Marshal, h.DefaultClient.Get)
+	h.
+		Head("z")
+}
+`
+
+func TestSelectors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "import alias",
+			opt:  Options{Classes: "x", Pattern: "^net/http\\.Get$"},
+			want1: []Match{
+				{Line: 10, Column: 2, Offset: 97, Class: "selector", Token: "net/http.Get", Text: "\th.Get(\"x\") // not http.Get in a comment", Start: 1, End: 6},
+			},
+		},
+
+		{
+			name: "package",
+			opt:  Options{Classes: "x", Pattern: "^net/http\\."},
+			want1: []Match{
+				{Line: 9, Column: 13, Offset: 84, Class: "selector", Token: "net/http.Client", Text: "func get(c *h.Client) {", Start: 12, End: 20},
+				{Line: 10, Column: 2, Offset: 97, Class: "selector", Token: "net/http.Get", Text: "\th.Get(\"x\") // not http.Get in a comment", Start: 1, End: 6},
+				{Line: 13, Column: 28, Offset: 203, Class: "selector", Token: "net/http.DefaultClient", Text: "\tfmt.Println(yaml.Marshal, h.DefaultClient.Get)", Start: 27, End: 42},
+				{Line: 14, Column: 2, Offset: 225, Class: "selector", Token: "net/http.Head", Text: "\th.", Start: 1, End: 3},
+			},
+		},
+
+		{
+			name: "receiver",
+			opt:  Options{Classes: "x", Pattern: "^c\\.Get$"},
+			want1: []Match{
+				{Line: 12, Column: 2, Offset: 167, Class: "selector", Token: "c.Get", Text: "\tc.Get(s)", Start: 1, End: 6},
+			},
+		},
+
+		{
+			name: "package name guessed",
+			opt:  Options{Classes: "x", Pattern: "^gopkg.in/yaml.v3\\.Marshal$"},
+			want1: []Match{
+				{Line: 13, Column: 14, Offset: 189, Class: "selector", Token: "gopkg.in/yaml.v3.Marshal", Text: "\tfmt.Println(yaml.Marshal, h.DefaultClient.Get)", Start: 13, End: 25},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, selectors)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("selectors got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const sequences = `package sequences
+
+func f() {
+	go run(1)
+	go s.run()
+	defer func() {
+		if r := recover(); r != nil {
+		}
+	}()
+}
+`
+
+func TestSequences(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+
+		want1 []Match
+	}{
+		{
+			name: "call",
+			opt:  Options{Sequence: true, Pattern: "k:go i: o:\\("},
+			want1: []Match{
+				{Line: 4, Column: 2, Offset: 31, Class: "sequence", Token: "go run(", Text: "\tgo run(1)", Start: 1, End: 8},
+			},
+		},
+
+		{
+			name:  "whole tokens",
+			opt:   Options{Sequence: true, Pattern: "k:go i:ru"},
+			want1: nil,
+		},
+
+		{
+			name: "repetition across lines",
+			opt:  Options{Sequence: true, Pattern: "k:defer k:func o:\\( o:\\) o:{ _ {0,8} d:recover"},
+			want1: []Match{
+				{Line: 6, Column: 2, Offset: 54, Class: "sequence", Token: "defer func() {\n\t\tif r := recover", Text: "\tdefer func() {", Start: 1, End: 15},
+			},
+		},
+
+		{
+			name: "inverted with max count",
+			opt:  Options{Sequence: true, Pattern: "k:defer", Invert: true, MaxCount: 2},
+			want1: []Match{
+				{Line: 1, Column: 1, Offset: 0, Class: "sequence", Token: "package", Text: "package sequences", Start: 0, End: 0},
+				{Line: 3, Column: 1, Offset: 19, Class: "sequence", Token: "func", Text: "func f() {", Start: 0, End: 0},
+			},
+		},
+
+		{
+			name: "fewest tokens",
+			opt:  Options{Sequence: true, Pattern: "k:go _ * o:\\)"},
+			want1: []Match{
+				{Line: 4, Column: 2, Offset: 31, Class: "sequence", Token: "go run(1)", Text: "\tgo run(1)", Start: 1, End: 10},
+				{Line: 5, Column: 2, Offset: 42, Class: "sequence", Token: "go s.run()", Text: "\tgo s.run()", Start: 1, End: 11},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got1 := searchSource(t, tt.opt, sequences)
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("sequences got1 = %v, want1: %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+const todo = `package todo
+
+// TODO: check the error
+func f() {}
+`
+
+func TestColonPatterns(t *testing.T) {
+	want := []Match{
+		{Line: 3, Column: 1, Offset: 14, Class: "comment", Token: "// TODO: check the error", Text: "// TODO: check the error", Start: 3, End: 8},
+	}
+	for _, opt := range []Options{
+		{Classes: "c", Pattern: "TODO:"},
+		{Classes: "c", Patterns: []string{"TODO:"}},
+		{Classes: "i", Patterns: []string{"c:TODO:"}},
+	} {
+		got := searchSource(t, opt, todo)
+		for i := range got {
+			got[i].Pattern = ""
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v got = %v, want: %v", opt, got, want)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+	}{
+		{
+			name: "invalid regexp",
+			opt:  Options{Classes: "c", Pattern: "*"},
+		},
+
+		{
+			name: "unrecognized token class",
+			opt:  Options{Classes: "cj", Pattern: "x"},
+		},
+
+		{
+			name: "unknown syntax node kind",
+			opt:  Options{AST: "func,funcs", Pattern: "x"},
+		},
+
+		{
+			name: "token sequence without classes",
+			opt:  Options{Sequence: true, Pattern: "go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opt, nil); err == nil {
+				t.Errorf("New error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMaxTotal(t *testing.T) {
+	var names []string
+	s, err := New(Options{Classes: "c", Pattern: "(?i)fetch", MaxTotal: 1, Ordered: true}, func(r *Result) {
+		names = append(names, r.Name)
+	})
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		s.Scan(name, []byte(sample))
+	}
+	s.Complete()
+
+	if want := []string{"a.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("MaxTotal reported %v, want %v", names, want)
+	}
+}
+
+func TestQuietValues(t *testing.T) {
+	// as "gg -q v 255": the exit status is that of the matches counted
+	var names []string
+	s, err := New(Options{Classes: "v", Pattern: "255", MaxTotal: 1, Ordered: true}, func(r *Result) {
+		names = append(names, r.Name)
+	})
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		s.Scan(name, []byte(sample))
+	}
+	summary := s.Complete()
+
+	if want := []string{"a.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("quiet value search reported %v, want %v", names, want)
+	}
+	if summary.Matches < 1 {
+		t.Errorf("quiet value search counted %d matches, want at least 1", summary.Matches)
+	}
+}
@@ -0,0 +1,364 @@
+package search
+
+import (
+	"errors"
+	"go/ast"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// semanticKinds are the relations to an object that semantic mode finds:
+// its definition; references to it; calls of it; and, for an interface or
+// an interface method, the types and methods that implement it.
+var semanticKinds = []string{"def", "ref", "call", "impl"}
+
+// semanticClass names the matches of each kind
+var semanticClass = map[string]string{
+	"def":  "definition",
+	"ref":  "reference",
+	"call": "call",
+	"impl": "implementation",
+}
+
+// semanticMatch is an identifier found by type checking to be related to
+// the object named by a pattern
+type semanticMatch struct {
+	class      string
+	pattern    string // the pattern naming the object, when one of several
+	line       int
+	start, end int // offsets of the identifier in its file
+}
+
+// Packages loads the Go packages named by the patterns, as the go command
+// reads them ("./..." or "net/http"), with their tests, type checks them,
+// and scans their files for the objects named by the patterns of a semantic
+// search. Packages are loaded from local source and the module cache
+// without a network unless GOFLAGS or GOPROXY say otherwise.
+func (s *Searcher) Packages(patterns ...string) error {
+	if s.semantic == nil {
+		return errors.New("not a semantic search")
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+		Env:   offline(os.Environ()),
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return err
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, err := range pkg.Errors {
+			s.printf("semantic search: %v", err) // types of the rest may still be known
+		}
+	})
+
+	// the objects named by the patterns, by import path so that each
+	// package, and each test variant of one, finds its own
+	imported := map[string][]*types.Package{}
+	var roots []*types.Package
+	for _, pkg := range pkgs {
+		if pkg.Types != nil {
+			roots = append(roots, pkg.Types)
+			addImports(imported, pkg.Types)
+		}
+	}
+	names := make([]string, len(s.matchers))
+	for i, m := range s.matchers {
+		if _, names[i], err = lookupObject(m.object, imported, roots); err != nil {
+			return err
+		}
+	}
+
+	// match identifiers in the files of each package, once though a file
+	// is in both a package and its test variant
+	type key struct {
+		name string
+		sm   semanticMatch
+	}
+	found := map[string][]semanticMatch{}
+	seen := map[key]bool{}
+	var files []string
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		visible := map[string][]*types.Package{}
+		addImports(visible, pkg.Types)
+		for i, m := range s.matchers {
+			obj, _, err := lookupObject(names[i], visible, nil)
+			if err != nil {
+				continue // not seen by this package
+			}
+			for _, rel := range s.relations(pkg, obj) {
+				p := pkg.Fset.PositionFor(rel.ident.Pos(), false)
+				k := key{relativeName(p.Filename), semanticMatch{rel.class, m.pattern, p.Line, p.Offset, p.Offset + len(rel.ident.Name)}}
+				if !seen[k] {
+					seen[k] = true
+					found[k.name] = append(found[k.name], k.sm)
+				}
+			}
+		}
+		for _, file := range pkg.GoFiles {
+			if k := (key{name: relativeName(file)}); !seen[k] {
+				seen[k] = true
+				files = append(files, k.name)
+			}
+		}
+	}
+	for _, matches := range found {
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	}
+
+	s.foundLock.Lock()
+	for name, matches := range found {
+		s.found[name] = matches
+	}
+	s.foundLock.Unlock()
+	for _, name := range files {
+		s.Scan(name, nil)
+	}
+	return nil
+}
+
+// offline returns an environment for the go command in which modules are
+// found in the module cache, not downloaded, unless env says otherwise
+func offline(env []string) []string {
+	if os.Getenv("GOFLAGS") == "" {
+		env = append(env, "GOFLAGS=-mod=mod")
+	}
+	if os.Getenv("GOPROXY") == "" {
+		env = append(env, "GOPROXY=off")
+	}
+	return env
+}
+
+// relativeName returns a file name relative to the current directory when
+// the file is within it, as the files of other searches are named
+func relativeName(name string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return name
+}
+
+// addImports records a package and those it imports by path. A path may
+// name several packages: a package and its variant with tests.
+func addImports(imported map[string][]*types.Package, pkg *types.Package) {
+	for _, p := range imported[pkg.Path()] {
+		if p == pkg {
+			return
+		}
+	}
+	imported[pkg.Path()] = append(imported[pkg.Path()], pkg)
+	for _, p := range pkg.Imports() {
+		addImports(imported, p)
+	}
+}
+
+// lookupObject finds the object named by a semantic search pattern: a
+// package-level object, "os.Open" or "io.Reader"; or a method or field of a
+// type, "os.File.Close" or "(*os.File).Close". The package is named by its
+// import path, "net/http.Client", or omitted for the loaded packages,
+// "Searcher.Scan". It also returns the name of the object with its package
+// path, "gg/search.Searcher.Scan", by which other packages find it.
+func lookupObject(pattern string, imported map[string][]*types.Package, roots []*types.Package) (types.Object, string, error) {
+	query := pattern
+	if strings.HasPrefix(query, "(") { // "(*os.File).Close"
+		if i := strings.Index(query, ")."); i > 0 {
+			query = strings.TrimPrefix(query[1:i], "*") + query[i+1:]
+		}
+	}
+
+	// the longest import path that prefixes the query...
+	var scopes []*types.Package
+	path := ""
+	for p, pkgs := range imported {
+		if strings.HasPrefix(query, p+".") && len(p) > len(path) {
+			path, scopes = p, pkgs
+		}
+	}
+	// ...or else the loaded packages
+	if path == "" {
+		scopes = roots
+	} else {
+		query = query[len(path)+1:]
+	}
+
+	names := strings.Split(query, ".")
+	if len(names) > 2 {
+		return nil, "", errors.New("semantic search: malformed object name: " + pattern)
+	}
+	for _, pkg := range scopes {
+		obj := pkg.Scope().Lookup(names[0])
+		if obj == nil {
+			continue
+		}
+		if len(names) == 1 {
+			return obj, pkg.Path() + "." + query, nil
+		}
+		if _, ok := obj.(*types.TypeName); ok {
+			if member, _, _ := types.LookupFieldOrMethod(obj.Type(), true, obj.Pkg(), names[1]); member != nil {
+				return member, pkg.Path() + "." + query, nil
+			}
+		}
+	}
+	return nil, "", errors.New("semantic search: no such object: " + pattern)
+}
+
+// related is an identifier and how it relates to the object searched for
+type related struct {
+	ident *ast.Ident
+	class string
+}
+
+// relations returns the identifiers in a type checked package that define,
+// refer to, or call obj, or implement it, as selected by the search's kinds
+func (s *Searcher) relations(pkg *packages.Package, obj types.Object) []related {
+	info := pkg.TypesInfo
+	obj = origin(obj)
+	var result []related
+	if s.semantic["def"] {
+		for id, def := range info.Defs {
+			if def != nil && origin(def) == obj {
+				result = append(result, related{id, semanticClass["def"]})
+			}
+		}
+	}
+	if s.semantic["ref"] {
+		for id, use := range info.Uses {
+			if origin(use) == obj {
+				result = append(result, related{id, semanticClass["ref"]})
+			}
+		}
+	}
+	if s.semantic["call"] {
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if id := callee(call.Fun); id != nil && origin(info.Uses[id]) == obj {
+						result = append(result, related{id, semanticClass["call"]})
+					}
+				}
+				return true
+			})
+		}
+	}
+	if s.semantic["impl"] {
+		for id, def := range info.Defs {
+			if def != nil && implements(def, obj) {
+				result = append(result, related{id, semanticClass["impl"]})
+			}
+		}
+	}
+	return result
+}
+
+// callee returns the identifier naming the function called, "f" in "f(x)",
+// "x.f(y)", and "f[T](x)", or nil if it is not named
+func callee(fun ast.Expr) *ast.Ident {
+	for {
+		switch x := fun.(type) {
+		case *ast.ParenExpr:
+			fun = x.X
+		case *ast.IndexExpr:
+			fun = x.X
+		case *ast.IndexListExpr:
+			fun = x.X
+		case *ast.SelectorExpr:
+			return x.Sel
+		case *ast.Ident:
+			return x
+		default:
+			return nil
+		}
+	}
+}
+
+// implements reports whether def, a defined type or a method, implements
+// obj, an interface type or an interface method
+func implements(def, obj types.Object) bool {
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		iface, ok := obj.Type().Underlying().(*types.Interface)
+		return ok && isImplementation(def, iface)
+	case *types.Func:
+		recv := obj.Type().(*types.Signature).Recv()
+		if recv == nil || def.Name() != obj.Name() {
+			return false
+		}
+		iface, ok := recv.Type().Underlying().(*types.Interface)
+		if !ok {
+			return false
+		}
+		method, ok := def.(*types.Func)
+		if !ok || method.Type().(*types.Signature).Recv() == nil {
+			return false
+		}
+		named, ok := derefNamed(method.Type().(*types.Signature).Recv().Type())
+		return ok && isImplementation(named.Obj(), iface)
+	}
+	return false
+}
+
+// isImplementation reports whether def is a concrete, non-generic type that
+// implements iface by value or by pointer
+func isImplementation(def types.Object, iface *types.Interface) bool {
+	tn, ok := def.(*types.TypeName)
+	if !ok || tn.IsAlias() {
+		return false
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 || types.IsInterface(named) {
+		return false
+	}
+	return types.Implements(named, iface) || types.Implements(types.NewPointer(named), iface)
+}
+
+func derefNamed(t types.Type) (*types.Named, bool) {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return named, ok
+}
+
+// origin returns the generic object of an instantiated one
+func origin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return obj
+}
+
+// scanSemantic reports the matches found for a file by Packages
+func (s *Searcher) scanSemantic(name string, source []byte, r *Result) {
+	s.foundLock.Lock()
+	matches := s.found[name]
+	s.foundLock.Unlock()
+
+	f := &fileScan{source: source, r: r}
+	for _, sm := range matches {
+		if s.enough(r) || sm.end > len(source) {
+			break
+		}
+		r.Summary.Matches++
+		if f.printLine < sm.line {
+			f.m = &matcher{pattern: sm.pattern}
+			f.add(sm.line, sm.start, []int{sm.start, sm.end}, sm.class, source[sm.start:sm.end], f.lineAt(sm.start))
+		}
+	}
+}
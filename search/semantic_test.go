@@ -0,0 +1,157 @@
+package search
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+const semanticSource = `package p
+
+type Reader interface{ Read() int }
+
+type File struct{}
+
+func (f *File) Read() int { return 0 }
+func (f *File) Close()    {}
+
+type Other struct{}
+
+func (Other) Close() {}
+
+func use(f *File, o Other, r Reader) {
+	f.Close()
+	o.Close()
+	g := f.Close
+	g()
+	r.Read()
+}
+`
+
+// checkSource type checks source as the only file of package p
+func checkSource(t *testing.T, source string) *packages.Package {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}, Uses: map[*ast.Ident]types.Object{}}
+	pkg, err := new(types.Config).Check("p", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &packages.Package{PkgPath: "p", Fset: fset, Syntax: []*ast.File{file}, Types: pkg, TypesInfo: info}
+}
+
+func TestRelations(t *testing.T) {
+	pkg := checkSource(t, semanticSource)
+	tests := []struct {
+		kinds  string
+		object string
+
+		want []string
+	}{
+		{"def", "(*p.File).Close", []string{"definition 8:16"}},
+		{"ref", "p.File.Close", []string{"reference 15:4", "reference 17:9"}},
+		{"call", "File.Close", []string{"call 15:4"}},
+		{"call", "Reader.Read", []string{"call 19:4"}},
+		{"impl", "Reader", []string{"implementation 5:6"}},
+		{"impl", "Reader.Read", []string{"implementation 7:16"}},
+		{"all", "Other.Close", []string{"call 16:4", "definition 12:14", "reference 16:4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kinds+" "+tt.object, func(t *testing.T) {
+			kinds, err := parseKinds(tt.kinds, "semantic relation", semanticKinds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			obj, _, err := lookupObject(tt.object, map[string][]*types.Package{"p": {pkg.Types}}, []*types.Package{pkg.Types})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, rel := range (&Searcher{semantic: kinds}).relations(pkg, obj) {
+				p := pkg.Fset.Position(rel.ident.Pos())
+				got = append(got, fmt.Sprintf("%s %d:%d", rel.class, p.Line, p.Column))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lookupObjectErrors(t *testing.T) {
+	pkg := checkSource(t, semanticSource)
+	for _, object := range []string{"p.Missing", "File.Missing", "p.File.Close.X", "Reader.Read.X"} {
+		if _, _, err := lookupObject(object, map[string][]*types.Package{"p": {pkg.Types}}, []*types.Package{pkg.Types}); err == nil {
+			t.Errorf("lookupObject(%q) error = nil, want error", object)
+		}
+	}
+}
+
+func Test_lookupObjectName(t *testing.T) {
+	pkg := checkSource(t, semanticSource)
+	for object, want := range map[string]string{"File": "p.File", "(*p.File).Close": "p.File.Close", "Reader.Read": "p.Reader.Read"} {
+		_, name, err := lookupObject(object, map[string][]*types.Package{"p": {pkg.Types}}, []*types.Package{pkg.Types})
+		if err != nil || name != want {
+			t.Errorf("lookupObject(%q) name = %q, %v, want %q", object, name, err, want)
+		}
+	}
+}
+
+// testedModule is a module whose package has tests in the package and in
+// an external test package
+var testedModule = map[string]string{
+	"go.mod":           "module example.com/p\n\ngo 1.21\n",
+	"p.go":             "package p\n\nfunc Func() int { return 1 }\n",
+	"p_test.go":        "package p\n\nimport \"testing\"\n\nfunc TestFunc(t *testing.T) { Func() }\n",
+	"external_test.go": "package p_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/p\"\n)\n\nfunc TestExternal(t *testing.T) { p.Func() }\n",
+}
+
+func TestPackagesTests(t *testing.T) {
+	dir := t.TempDir()
+	for name, source := range testedModule {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var got []string
+	s, err := New(Options{Semantic: "def,call", Pattern: "Func", Ordered: true}, func(r *Result) {
+		for _, m := range r.Matches {
+			got = append(got, fmt.Sprintf("%s:%d %s", r.Name, m.Line, m.Class))
+		}
+	})
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+	if err := s.Packages("."); err != nil {
+		t.Fatalf("Packages error = %v", err)
+	}
+	s.Complete()
+	sort.Strings(got)
+
+	want := []string{"external_test.go:9 call", "p.go:3 definition", "p_test.go:5 call"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Packages found %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,308 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/MichaelTJones/lex"
+)
+
+// maxRepeat bounds the counts of a repetition, "{m,n}"
+const maxRepeat = 1000
+
+// seqElement matches one token, or a run of them, in a token sequence
+type seqElement struct {
+	any         bool           // "_": any token
+	mode        searchMode     // otherwise a token of these classes...
+	regex       *regexp.Regexp // ...whose whole text this matches, if not nil
+	least, most int            // how many tokens, most -1 for any number
+}
+
+// parseSequence compiles a token sequence pattern, "k:go i: o:\(", a list
+// of words separated by spaces. Each word matches a token: "classes:regexp"
+// one of the classes, by letters as in Options.Classes, whose whole text
+// the regexp matches, "k:go" matching "go" but not "goto"; "classes:" any
+// token of the classes; and "_" any token at all. A word may be followed by
+// a repetition, "?", "*", "+", "{m}", "{m,}", or "{m,n}", that matches as
+// few tokens as it can, as in "k:defer _ {0,20} d:recover".
+func parseSequence(pattern string, fixed, ignoreCase bool) ([]seqElement, error) {
+	var seq []seqElement
+	last := -1 // the element a repetition repeats
+	for _, word := range strings.Fields(pattern) {
+		if least, most, ok := parseRepeat(word); ok {
+			if last < 0 {
+				return nil, errors.New("token sequence: repetition of nothing: " + word)
+			}
+			if least > maxRepeat || most > maxRepeat || (most >= 0 && least > most) {
+				return nil, errors.New("token sequence: bad repetition count: " + word)
+			}
+			seq[last].least, seq[last].most = least, most
+			last = -1
+			continue
+		}
+
+		e := seqElement{least: 1, most: 1}
+		if word == "_" {
+			e.any = true
+		} else {
+			i := strings.IndexByte(word, ':')
+			if i <= 0 || strings.Trim(word[:i], classLetters) != "" {
+				return nil, errors.New("token sequence: want classes:regexp or _: " + word)
+			}
+			mode, err := parseFirstArg(word[:i])
+			if err != nil {
+				return nil, err
+			}
+			if !(mode.D || mode.E || mode.I || mode.K || mode.N || mode.O || mode.P || mode.R || mode.S || mode.T) {
+				return nil, errors.New("token sequence: no token classes in " + word)
+			}
+			e.mode = mode
+			if re := word[i+1:]; re != "" {
+				e.regex, err = getRegexp(`^(?:` + getPattern(re, fixed, false, ignoreCase) + `)$`)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		last = len(seq)
+		seq = append(seq, e)
+	}
+	if len(seq) == 0 {
+		return nil, errors.New("token sequence: empty pattern")
+	}
+	return seq, nil
+}
+
+// parseRepeat parses a repetition: "?", "*", "+", "{m}", "{m,}", or "{m,n}".
+// most is -1 when there is no limit.
+func parseRepeat(word string) (least, most int, ok bool) {
+	switch word {
+	case "?":
+		return 0, 1, true
+	case "*":
+		return 0, -1, true
+	case "+":
+		return 1, -1, true
+	}
+	if len(word) < 3 || word[0] != '{' || word[len(word)-1] != '}' {
+		return 0, 0, false
+	}
+	lo, hi, comma := strings.Cut(word[1:len(word)-1], ",")
+	least, err := strconv.Atoi(lo)
+	if err != nil || least < 0 {
+		return 0, 0, false
+	}
+	switch {
+	case !comma:
+		return least, least, true
+	case hi == "":
+		return least, -1, true
+	}
+	most, err = strconv.Atoi(hi)
+	if err != nil {
+		return 0, 0, false
+	}
+	return least, most, true
+}
+
+// seqToken is a significant token: not space or a comment
+type seqToken struct {
+	class       string
+	text        []byte
+	offset      int
+	line        int
+	packageName bool // the identifier after "package"
+}
+
+// match reports whether the element matches the token
+func (e *seqElement) match(t *seqToken) bool {
+	if !e.any {
+		m := &e.mode
+		var ok bool
+		switch t.class {
+		case "identifier":
+			ok = m.I || m.E || (t.packageName && m.P)
+		case "keyword":
+			ok = m.K
+		case "operator":
+			ok = m.O
+		case "rune":
+			ok = m.R
+		case "string":
+			ok = m.S
+		case "type":
+			ok = m.T
+		case "defined":
+			ok = m.D
+		case "number":
+			ok = m.N
+		}
+		if !ok {
+			return false
+		}
+	}
+	return e.regex == nil || e.regex.Match(t.text)
+}
+
+// sequenceTokens returns the significant tokens of a source file
+func sequenceTokens(source []byte) []seqToken {
+	var tokens []seqToken
+	lexer := lex.NewLexer(source, lex.ScanGo)
+	offset := 0
+	for tok, text := lexer.Scan(); tok != lex.EOF; tok, text = lexer.Scan() {
+		if tok < 0 && int(-tok) < len(className) && className[-tok] != "" && tok != lex.Comment && len(bytes.TrimSpace(text)) > 0 {
+			packageName := tok == lex.Identifier && len(tokens) > 0 && tokens[len(tokens)-1].class == "keyword" && bytes.Equal(tokens[len(tokens)-1].text, []byte("package"))
+			tokens = append(tokens, seqToken{className[-tok], text, offset, lexer.Line, packageName})
+		}
+		offset += len(text)
+	}
+	return tokens
+}
+
+// sequenceMatcher finds a token sequence in a file's tokens, remembering
+// for each element the tokens where it has been tried
+type sequenceMatcher struct {
+	seq    []seqElement
+	tokens []seqToken
+	ends   seqMemo // end of the shortest match of the rest, -1 for none
+	runs   seqMemo // length of the run of tokens that the element matches
+	starts seqMemo // first token on where the rest matches, -1 for none
+}
+
+// seqMemo holds a number, -1 or more, for each element and token. An
+// element's row is made when it is first used.
+type seqMemo [][]int32 // 0 unknown, else the number plus 2
+
+func (m seqMemo) get(e, t int) (int, bool) {
+	if m[e] == nil {
+		return 0, false
+	}
+	return int(m[e][t]) - 2, m[e][t] != 0
+}
+
+func (m seqMemo) set(e, t, n, tokens int) {
+	if m[e] == nil {
+		m[e] = make([]int32, tokens+1)
+	}
+	m[e][t] = int32(n + 2)
+}
+
+func newSequenceMatcher(seq []seqElement, tokens []seqToken) *sequenceMatcher {
+	return &sequenceMatcher{seq: seq, tokens: tokens, ends: make(seqMemo, len(seq)), runs: make(seqMemo, len(seq)), starts: make(seqMemo, len(seq)+1)}
+}
+
+// end returns the index after the last token of the shortest match of the
+// sequence from element e at token t onward, or -1 if there is none
+func (sm *sequenceMatcher) end(e, t int) int {
+	if e == len(sm.seq) {
+		return t
+	}
+	if end, ok := sm.ends.get(e, t); ok {
+		return end
+	}
+	// the element matches from least tokens up to the run it matches or its
+	// most, and the rest of the sequence after as few as possible
+	el := &sm.seq[e]
+	last := t + sm.run(e, t)
+	if el.most >= 0 && last > t+el.most {
+		last = t + el.most
+	}
+	end := -1
+	if first := t + el.least; first <= last {
+		if u := sm.start(e+1, first); u >= 0 && u <= last {
+			end = sm.end(e+1, u)
+		}
+	}
+	sm.ends.set(e, t, end, len(sm.tokens))
+	return end
+}
+
+// run returns the number of tokens from token t on that element e matches
+func (sm *sequenceMatcher) run(e, t int) int {
+	var passed []int
+	n := 0
+	for u := t; ; u++ {
+		if known, ok := sm.runs.get(e, u); ok {
+			n = known
+			break
+		}
+		if u == len(sm.tokens) || !sm.seq[e].match(&sm.tokens[u]) {
+			sm.runs.set(e, u, 0, len(sm.tokens))
+			break
+		}
+		passed = append(passed, u)
+	}
+	for i := len(passed) - 1; i >= 0; i-- {
+		n++
+		sm.runs.set(e, passed[i], n, len(sm.tokens))
+	}
+	return n
+}
+
+// start returns the first token from token t on where the sequence from
+// element e matches, or -1 if there is none
+func (sm *sequenceMatcher) start(e, t int) int {
+	var passed []int
+	first := -1
+	for u := t; u <= len(sm.tokens); u++ {
+		if known, ok := sm.starts.get(e, u); ok {
+			first = known
+			break
+		}
+		passed = append(passed, u)
+		if sm.end(e, u) >= 0 {
+			first = u
+			break
+		}
+	}
+	for _, u := range passed {
+		sm.starts.set(e, u, first, len(sm.tokens))
+	}
+	return first
+}
+
+// scanSequences matches the token sequences of the matchers at each token
+// of a file, reporting a line at the first sequence that begins on it
+func (s *Searcher) scanSequences(matchers []*matcher, source []byte, r *Result) {
+	tokens := sequenceTokens(source)
+	r.Summary.Tokens = len(tokens)
+	sms := make([]*sequenceMatcher, len(matchers))
+	for i, m := range matchers {
+		sms[i] = newSequenceMatcher(m.sequence, tokens)
+	}
+
+	f := &fileScan{source: source, r: r, invert: s.opt.Invert}
+	for t := range tokens {
+		if s.enough(r) {
+			break
+		}
+		first := &tokens[t]
+		for i, m := range matchers {
+			f.m = m
+			end := sms[i].end(0, t)
+			if end <= t {
+				end = -1 // an empty match is not a match
+			}
+			if f.invert {
+				f.note(first.line, first.offset, "sequence", first.text, end >= 0)
+				continue
+			}
+			if end < 0 {
+				continue
+			}
+			r.Summary.Matches++
+			if f.printLine < first.line {
+				last := &tokens[end-1]
+				span := []int{first.offset, last.offset + len(last.text)}
+				f.add(first.line, first.offset, span, "sequence", source[span[0]:span[1]], f.lineAt(first.offset))
+			}
+			break
+		}
+	}
+	if f.invert && !s.enough(r) {
+		f.flush()
+	}
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_parseRepeat(t *testing.T) {
+	tests := []struct {
+		word        string
+		least, most int
+		ok          bool
+	}{
+		{"?", 0, 1, true},
+		{"*", 0, -1, true},
+		{"+", 1, -1, true},
+		{"{3}", 3, 3, true},
+		{"{2,}", 2, -1, true},
+		{"{0,20}", 0, 20, true},
+		{"{}", 0, 0, false},
+		{"{x}", 0, 0, false},
+		{"{1,y}", 0, 0, false},
+		{"i:", 0, 0, false},
+	}
+	for _, tt := range tests {
+		least, most, ok := parseRepeat(tt.word)
+		if least != tt.least || most != tt.most || ok != tt.ok {
+			t.Errorf("parseRepeat(%q) = %d, %d, %v, want %d, %d, %v", tt.word, least, most, ok, tt.least, tt.most, tt.ok)
+		}
+	}
+}
+
+func Test_parseSequence(t *testing.T) {
+	tests := []struct {
+		pattern string
+		counts  string // the least and most tokens of each element, -1 for any
+	}{
+		{`k:go i: o:\(`, "1,1 1,1 1,1"},
+		{`k:defer _ {0,3} d:recover`, "1,1 0,3 1,1"},
+		{`i: + o:\.`, "1,-1 1,1"},
+		{`_ {2,} s:`, "2,-1 1,1"},
+		{`_ {0,1000}`, "0,1000"},
+	}
+	for _, tt := range tests {
+		seq, err := parseSequence(tt.pattern, false, false)
+		if err != nil {
+			t.Errorf("parseSequence(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		var counts []string
+		for _, e := range seq {
+			counts = append(counts, fmt.Sprintf("%d,%d", e.least, e.most))
+		}
+		if got := strings.Join(counts, " "); got != tt.counts {
+			t.Errorf("parseSequence(%q) counts = %q, want %q", tt.pattern, got, tt.counts)
+		}
+	}
+
+	for _, pattern := range []string{"", "go", "* k:go", "k:go * *", "v:1", "k:(", "i: {3,2}", "i: {2000}"} {
+		if _, err := parseSequence(pattern, false, false); err == nil {
+			t.Errorf("parseSequence(%q) error = nil, want error", pattern)
+		}
+	}
+}
+
+func Test_sequenceMatcherLarge(t *testing.T) {
+	// every "var" begins a run of tokens that never reaches "recover"
+	source := "package p\n\n" + strings.Repeat("var x = f(1, 2) + 3\n", 40000)
+	tokens := sequenceTokens([]byte(source))
+	for _, pattern := range []string{"k:var _ * d:recover", "k:var _ {0,1000} d:recover", "_ {0,1000} d:recover"} {
+		seq, err := parseSequence(pattern, false, false)
+		if err != nil {
+			t.Fatalf("parseSequence(%q) error = %v", pattern, err)
+		}
+		sm := newSequenceMatcher(seq, tokens)
+		for i := range tokens {
+			if end := sm.end(0, i); end >= 0 {
+				t.Fatalf("%q matched tokens %d to %d, want no match", pattern, i, end)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitTagQuery separates a struct tag search, "json:omitempty", into the key
+// whose value is searched and the pattern for that value. A search without
+// a key, "omitempty", is for the whole tag.
+func splitTagQuery(input string) (key, pattern string) {
+	i := strings.IndexByte(input, ':')
+	if i <= 0 || !isTagKey(input[:i]) {
+		return "", input
+	}
+	return input[:i], input[i+1:]
+}
+
+// isTagKey reports whether s may be a struct tag key: printable ASCII other
+// than space, quote, and colon
+func isTagKey(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == ':' || c == '"' || c == 0x7f {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// lookupTag returns the value associated with key in the struct tag, and
+// the offsets in tag of its quoted form, as reflect.StructTag's Lookup
+// does. ok is false when the tag has no such key.
+func lookupTag(tag, key string) (value string, start, end int, ok bool) {
+	offset := 0
+	for tag != "" {
+		// skip leading space
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag, offset = tag[i:], offset+i
+		if tag == "" {
+			break
+		}
+
+		// scan to colon; a space, a quote or a control character is a syntax error
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := tag[:i]
+		tag, offset = tag[i+1:], offset+i+1
+
+		// scan quoted string to find value
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			break
+		}
+		quoted := tag[:i+1]
+		tag, start, offset = tag[i+1:], offset, offset+i+1
+
+		if key == name {
+			value, err := strconv.Unquote(quoted)
+			if err != nil {
+				break
+			}
+			return value, start, offset, true
+		}
+	}
+	return "", 0, 0, false
+}
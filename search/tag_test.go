@@ -0,0 +1,48 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_lookupTag(t *testing.T) {
+	tags := []string{
+		`json:"name,omitempty" db:"user_name"`,
+		`json:"-"`,
+		`  xml:"a\"b"   json:""`,
+		`json:name`,
+		`json:"unterminated`,
+		`bad key:"x" json:"y"`,
+		``,
+	}
+	for _, tag := range tags {
+		for _, key := range []string{"json", "db", "xml", "yaml"} {
+			want, wantOK := reflect.StructTag(tag).Lookup(key)
+			got, start, end, ok := lookupTag(tag, key)
+			if got != want || ok != wantOK {
+				t.Errorf("lookupTag(%q, %q) = %q, %v, want %q, %v", tag, key, got, ok, want, wantOK)
+			}
+			if ok && (tag[start] != '"' || tag[end-1] != '"') {
+				t.Errorf("lookupTag(%q, %q) quoted value = %q", tag, key, tag[start:end])
+			}
+		}
+	}
+}
+
+func Test_splitTagQuery(t *testing.T) {
+	tests := []struct {
+		input, key, pattern string
+	}{
+		{"json:omitempty", "json", "omitempty"},
+		{"db:^user_", "db", "^user_"},
+		{"json:", "json", ""},
+		{"omitempty", "", "omitempty"},
+		{":x", "", ":x"},
+		{"a b:c", "", "a b:c"},
+	}
+	for _, tt := range tests {
+		if key, pattern := splitTagQuery(tt.input); key != tt.key || pattern != tt.pattern {
+			t.Errorf("splitTagQuery(%q) = %q, %q, want %q, %q", tt.input, key, pattern, tt.key, tt.pattern)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package search
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// number is the exact value of a number literal or of a number in a value
+// query. Every spelling of a value has the same number: 0.25, .25, 25e-2, and
+// 0x1p-2 are one quarter, and 255, 255.0, and 0xff are equal. Imaginary
+// numbers, as 2i, are distinct from real ones.
+type number struct {
+	imag bool
+	r    *big.Rat
+}
+
+// maxExponent limits the exponents of literals read exactly. Go compilers
+// reject 1e1000000 as too large, and reading it would be a long wait.
+const maxExponent = 10000
+
+// parseNumber reads a number with an optional minus sign
+func parseNumber(s string) (number, error) {
+	if strings.HasPrefix(s, "-") {
+		return parseLiteral([]byte(s[1:]), true)
+	}
+	return parseLiteral([]byte(s), false)
+}
+
+// parseLiteral reads the text of a number literal, negated when neg is set
+// since its unary minus sign is a separate token
+func parseLiteral(text []byte, neg bool) (number, error) {
+	s := string(text)
+	if s == "" || strings.ContainsAny(s[:1], "+-") || strings.Contains(s, "/") {
+		return number{}, errors.New("invalid number: " + s) // big.Rat reads "+1" and "1/3"; Go does not
+	}
+	n := number{r: new(big.Rat)}
+	if strings.HasSuffix(s, "i") {
+		n.imag = true
+		s = s[:len(s)-1]
+		if isDecimalDigits(s) {
+			// "0123i" is 123i for backward compatibility
+			if s = strings.TrimLeft(s, "0_"); s == "" {
+				s = "0"
+			}
+		}
+	}
+
+	if u, err := strconv.ParseUint(s, 0, 64); err == nil {
+		n.r.SetUint64(u) // the common case, quickly
+	} else if i, ok := new(big.Int).SetString(s, 0); ok {
+		n.r.SetInt(i) // integers, with Go's base prefixes and octal "0377"
+	} else if err := checkExponent(s); err != nil {
+		return number{}, err
+	} else if _, ok := n.r.SetString(s); !ok {
+		return number{}, errors.New("invalid number: " + string(text))
+	}
+	if neg {
+		n.r.Neg(n.r)
+	}
+	return n, nil
+}
+
+// isDecimalDigits reports whether s is made only of decimal digits and "_"
+func isDecimalDigits(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// checkExponent rejects a float literal with an exponent beyond maxExponent
+func checkExponent(s string) error {
+	marks := "eE"
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		marks = "pP" // "e" is a hex digit
+	}
+	i := strings.IndexAny(s, marks)
+	if i < 0 {
+		return nil
+	}
+	e, err := strconv.Atoi(strings.TrimPrefix(strings.ReplaceAll(s[i+1:], "_", ""), "+"))
+	if err != nil {
+		return errors.New("invalid number: " + s)
+	}
+	if e > maxExponent || e < -maxExponent {
+		return errors.New("exponent too large: " + s)
+	}
+	return nil
+}
+
+// compare returns -1, 0, or +1 as a is less than, equal to, or greater than
+// b. ok is false when one is real and the other imaginary.
+func compare(a, b number) (c int, ok bool) {
+	if a.imag != b.imag {
+		return 0, false
+	}
+	return a.r.Cmp(b.r), true
+}
+
+// valueTerm is one condition on the value of a literal
+type valueTerm struct {
+	op   string // "==", "<", "<=", ">", ">=", ".." for x through y, "~" for x to y rounded, or "%" for nonzero multiples of x
+	x, y number
+}
+
+func (t valueTerm) match(lit number) bool {
+	switch t.op {
+	case "..":
+		c1, ok1 := compare(lit, t.x)
+		c2, ok2 := compare(lit, t.y)
+		return ok1 && ok2 && c1 >= 0 && c2 <= 0
+	case "~":
+		// halves round away from zero, so the interval is closed at the end
+		// nearer zero, and open at both ends when the rounded value is zero
+		c1, ok1 := compare(lit, t.x)
+		c2, ok2 := compare(lit, t.y)
+		if !ok1 || !ok2 {
+			return false
+		}
+		switch new(big.Rat).Add(t.x.r, t.y.r).Sign() { // of the rounded value
+		case 1:
+			return c1 >= 0 && c2 < 0
+		case -1:
+			return c1 > 0 && c2 <= 0
+		}
+		return c1 > 0 && c2 < 0
+	case "%":
+		if lit.imag || lit.r.Sign() == 0 {
+			return false
+		}
+		return new(big.Rat).Quo(lit.r, t.x.r).IsInt()
+	}
+	c, ok := compare(lit, t.x)
+	if !ok {
+		return false
+	}
+	switch t.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return c == 0
+}
+
+// valueQuery matches literals satisfying any of its terms
+type valueQuery []valueTerm
+
+func (q valueQuery) match(lit number) bool {
+	for _, t := range q {
+		if t.match(lit) {
+			return true
+		}
+	}
+	return false
+}
+
+// widen returns the query with each search for equality widened to a range
+// of the values within tolerance
+func (q valueQuery) widen(tol tolerance) valueQuery {
+	w := make(valueQuery, len(q))
+	for i, t := range q {
+		if t.op != "==" {
+			w[i] = t
+			continue
+		}
+		if d := tol.distance(t.x); d.Sign() > 0 {
+			t.op = ".."
+			t.y = number{imag: t.x.imag, r: new(big.Rat).Add(t.x.r, d)}
+			t.x = number{imag: t.x.imag, r: new(big.Rat).Sub(t.x.r, d)}
+		}
+		w[i] = t
+	}
+	return w
+}
+
+// parseValueQuery reads a value search: a number, "255"; a comparison,
+// ">=1e6"; an inclusive range with either end optional, "1024..65535";
+// nonzero multiples of a positive integer, "%4096"; a decimal number
+// that literals round to, "~3.14159"; or a set of these in braces,
+// "{8080,8443}".
+func parseValueQuery(input string) (valueQuery, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") && strings.HasSuffix(input, "}") {
+		q := valueQuery{}
+		for _, s := range strings.Split(input[1:len(input)-1], ",") {
+			t, err := parseValueTerm(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			q = append(q, t)
+		}
+		return q, nil
+	}
+	t, err := parseValueTerm(input)
+	if err != nil {
+		return nil, err
+	}
+	return valueQuery{t}, nil
+}
+
+func parseValueTerm(input string) (valueTerm, error) {
+	var err error
+	t := valueTerm{op: "=="}
+	switch {
+	case strings.HasPrefix(input, "%"):
+		t.op = "%"
+		if t.x, err = parseNumber(input[1:]); err != nil {
+			return t, err
+		}
+		if t.x.imag || !t.x.r.IsInt() || t.x.r.Sign() <= 0 {
+			return t, errors.New("multiples of " + input[1:] + ": not a positive integer")
+		}
+		return t, nil
+	case strings.HasPrefix(input, "~"):
+		return parseRounded(input[1:])
+	case strings.HasPrefix(input, ">="), strings.HasPrefix(input, "<="):
+		t.op, input = input[:2], input[2:]
+	case strings.HasPrefix(input, ">"), strings.HasPrefix(input, "<"):
+		t.op, input = input[:1], input[1:]
+	case strings.Contains(input, ".."):
+		i := strings.Index(input, "..")
+		low, high := input[:i], input[i+2:]
+		switch {
+		case low == "" && high == "":
+			return t, errors.New("range " + input + ": no bounds")
+		case low == "":
+			t.op, input = "<=", high
+		case high == "":
+			t.op, input = ">=", low
+		default:
+			t.op = ".."
+			if t.x, err = parseNumber(low); err != nil {
+				return t, err
+			}
+			t.y, err = parseNumber(high)
+			return t, err
+		}
+	}
+	t.x, err = parseNumber(input)
+	return t, err
+}
+
+// parseRounded reads a decimal number matched by the literals that round to
+// it at its last significant digit, with halves rounding away from zero:
+// "~3.14159" matches 3.141592653589793 but not 3.1416, and "~1.5e3" matches
+// 1450 up to but not including 1550.
+func parseRounded(input string) (valueTerm, error) {
+	t := valueTerm{op: "~"}
+	x, err := parseNumber(input)
+	if err != nil {
+		return t, err
+	}
+	s := strings.ReplaceAll(strings.TrimPrefix(input, "-"), "_", "")
+	if x.imag || (len(s) > 1 && s[0] == '0' && !strings.ContainsAny(s[1:2], ".eE")) {
+		return t, errors.New("rounded value " + input + ": not a decimal number")
+	}
+
+	// the place of the last significant digit is 10**(exponent - fraction digits)
+	exponent := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exponent, _ = strconv.Atoi(strings.TrimPrefix(s[i+1:], "+")) // checked by parseNumber
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exponent -= len(s) - i - 1
+	}
+	place := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil))
+	if exponent < 0 {
+		place.SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-exponent)), nil))
+		place.Inv(place)
+	}
+	half := place.Quo(place, big.NewRat(2, 1))
+	t.x = number{r: new(big.Rat).Sub(x.r, half)}
+	t.y = number{r: new(big.Rat).Add(x.r, half)}
+	return t, nil
+}
+
+// tolerance widens searches for values to those nearby. The widest of its
+// measures applies.
+type tolerance struct {
+	absolute *big.Rat // distance
+	relative *big.Rat // fraction of the value sought
+	ulps     float64  // units in the last place of the value sought as a float64
+}
+
+// parseTolerance reads a comma-separated list of tolerances: absolute,
+// "1e-9"; relative, as a percentage of the value sought, "0.01%"; or in
+// units in the last place of the value as a float64, "4ulp".
+func parseTolerance(input string) (tolerance, error) {
+	tol := tolerance{}
+	if input == "" {
+		return tol, nil
+	}
+	for _, s := range strings.Split(input, ",") {
+		s = strings.TrimSpace(s)
+		var err error
+		var x number
+		switch {
+		case strings.HasSuffix(s, "ulp"):
+			tol.ulps, err = strconv.ParseFloat(strings.TrimSuffix(s, "ulp"), 64)
+			if err == nil && !(tol.ulps >= 0 && tol.ulps <= math.MaxFloat64) {
+				err = errors.New("not a nonnegative real number") // NaN fails both
+			}
+		case strings.HasSuffix(s, "%"):
+			if x, err = parseNumber(strings.TrimSuffix(s, "%")); err == nil {
+				tol.relative = x.r.Quo(x.r, big.NewRat(100, 1))
+			}
+		default:
+			if x, err = parseNumber(s); err == nil {
+				tol.absolute = x.r
+			}
+		}
+		if err == nil && (x.imag || (x.r != nil && x.r.Sign() < 0)) {
+			err = errors.New("not a nonnegative real number")
+		}
+		if err != nil {
+			return tolerance{}, errors.New("tolerance " + s + ": " + err.Error())
+		}
+	}
+	return tol, nil
+}
+
+// distance returns how far from x values are within tolerance
+func (tol tolerance) distance(x number) *big.Rat {
+	d := new(big.Rat)
+	if tol.absolute != nil && tol.absolute.Cmp(d) > 0 {
+		d.Set(tol.absolute)
+	}
+	if tol.relative != nil {
+		if r := new(big.Rat).Mul(tol.relative, new(big.Rat).Abs(x.r)); r.Cmp(d) > 0 {
+			d = r
+		}
+	}
+	if tol.ulps > 0 {
+		f, _ := x.r.Float64()
+		f = math.Abs(f)
+		if ulp := math.Nextafter(f, math.Inf(1)) - f; !math.IsInf(ulp, 0) && !math.IsNaN(ulp) {
+			if r := new(big.Rat).SetFloat64(tol.ulps * ulp); r != nil && r.Cmp(d) > 0 {
+				d = r
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,266 @@
+package search
+
+import (
+	"testing"
+)
+
+// lit reads a literal as scan does, with any minus sign a separate token
+func lit(t *testing.T, s string) number {
+	n, err := parseNumber(s)
+	if err != nil {
+		t.Fatalf("parseNumber(%q) error = %v", s, err)
+	}
+	return n
+}
+
+func Test_valueQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+
+		match   []string
+		noMatch []string
+	}{
+		{
+			name:    "integer",
+			query:   "255",
+			match:   []string{"255", "0xff", "0377", "0o377", "0b1111_1111", "255.0", "2.55e2", "0x1.fep7"},
+			noMatch: []string{"254", "255i"},
+		},
+
+		{
+			name:    "float",
+			query:   "2.5e2",
+			match:   []string{"250", "250.0", "2.5e2", "0xfa"},
+			noMatch: []string{"251"},
+		},
+
+		{
+			name:    "exact fraction",
+			query:   "0.25",
+			match:   []string{".25", "25e-2", "0x1p-2", "0.250", "2_5e-2"},
+			noMatch: []string{"0.2500001", "0.25i"},
+		},
+
+		{
+			name:    "beyond uint64",
+			query:   "18446744073709551616",
+			match:   []string{"0x1_0000_0000_0000_0000", "1.8446744073709551616e19"},
+			noMatch: []string{"18446744073709551615", "1.8446744073709551615e19"},
+		},
+
+		{
+			name:    "imaginary",
+			query:   "2i",
+			match:   []string{"2i", "2.0i", "0x2p0i", "02i", "0b10i"},
+			noMatch: []string{"2", "3i"},
+		},
+
+		{
+			name:    "imaginary decimal with leading zero",
+			query:   "377i",
+			match:   []string{"0377i"},
+			noMatch: []string{"0o377i"},
+		},
+
+		{
+			name:    "range",
+			query:   "1024..65535",
+			match:   []string{"1024", "8080", "0xffff", "8080.0"},
+			noMatch: []string{"1023", "65536", "1023.5", "2048i"},
+		},
+
+		{
+			name:    "open range",
+			query:   "..10",
+			match:   []string{"0", "10"},
+			noMatch: []string{"11"},
+		},
+
+		{
+			name:    "comparison",
+			query:   ">=1e6",
+			match:   []string{"1e6", "1000000", "2.5e9"},
+			noMatch: []string{"999999", "0x1p10", "1e6i"},
+		},
+
+		{
+			name:    "less than",
+			query:   "<8",
+			match:   []string{"0", "7", "0b111", "7.5"},
+			noMatch: []string{"8"},
+		},
+
+		{
+			name:    "multiples",
+			query:   "%4096",
+			match:   []string{"4096", "0x2000", "65536", "4096.0"},
+			noMatch: []string{"0", "4095", "2048"},
+		},
+
+		{
+			name:    "set",
+			query:   "{8080, 8443, 9000..9099}",
+			match:   []string{"8080", "8443", "9050"},
+			noMatch: []string{"80", "9100"},
+		},
+
+		{
+			name:    "negative",
+			query:   "-1",
+			match:   []string{"-1", "-0x1", "-1.0"},
+			noMatch: []string{"1"},
+		},
+
+		{
+			name:    "signed range",
+			query:   "-10..-1",
+			match:   []string{"-10", "-5", "-1"},
+			noMatch: []string{"0", "-0", "1", "-11"},
+		},
+
+		{
+			name:    "rounded",
+			query:   "~3.14159",
+			match:   []string{"3.14159", "3.141592653589793", "3.141585", "0x1.921f9f01b866ep+01"},
+			noMatch: []string{"3.1416", "3.141595", "3.14158", "3", "3.14159i"},
+		},
+
+		{
+			name:    "rounded with exponent",
+			query:   "~1.5e3",
+			match:   []string{"1450", "1500", "1549.99"},
+			noMatch: []string{"1449", "1550"},
+		},
+
+		{
+			name:    "rounded negative",
+			query:   "~-2.5",
+			match:   []string{"-2.5", "-2.45", "-2.54"},
+			noMatch: []string{"2.5", "-2.55"},
+		},
+
+		{
+			name:    "rounded zero",
+			query:   "~0",
+			match:   []string{"0", "-0", "0.49", "-0.49"},
+			noMatch: []string{"0.5", "-0.5", "1", "-1"},
+		},
+
+		{
+			name:    "rounded halves",
+			query:   "{~1, ~-1}",
+			match:   []string{"0.5", "-0.5", "1.49", "-1.49"},
+			noMatch: []string{"1.5", "-1.5", "0.49", "-0.49"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseValueQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseValueQuery(%q) error = %v", tt.query, err)
+			}
+			for _, s := range tt.match {
+				if !q.match(lit(t, s)) {
+					t.Errorf("%q does not match %s, want match", tt.query, s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if q.match(lit(t, s)) {
+					t.Errorf("%q matches %s, want no match", tt.query, s)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseValueQueryErrors(t *testing.T) {
+	for _, query := range []string{"", "asdf", "..", "%0", "%1.5", "%-4", "%2i", ">=x", "{1,x}", "1..x", "1/3", "+5", "--5", "1e99999", "~0x10", "~0377", "~2i", "~x"} {
+		if _, err := parseValueQuery(query); err == nil {
+			t.Errorf("parseValueQuery(%q) error = nil, want error", query)
+		}
+	}
+}
+
+func Test_tolerance(t *testing.T) {
+	tests := []struct {
+		name      string
+		tolerance string
+		query     string
+
+		match   []string
+		noMatch []string
+	}{
+		{
+			name:      "absolute",
+			tolerance: "0.01",
+			query:     "3.14",
+			match:     []string{"3.13", "3.1415926", "3.15"},
+			noMatch:   []string{"3.12", "3.16", "3.14i"},
+		},
+
+		{
+			name:      "relative",
+			tolerance: "1%",
+			query:     "-200",
+			match:     []string{"-198", "-202"},
+			noMatch:   []string{"-197", "200"},
+		},
+
+		{
+			name:      "ulps",
+			tolerance: "1ulp",
+			query:     "0.1",
+			match:     []string{"0.1", "0.10000000000000001", "0.09999999999999999"},
+			noMatch:   []string{"0.1000000000000001", "0.0999999999999999"},
+		},
+
+		{
+			name:      "widest",
+			tolerance: "1ulp,0.5",
+			query:     "{10, 20..30}",
+			match:     []string{"9.5", "10.5", "25"},
+			noMatch:   []string{"9", "19.5", "30.5"},
+		},
+
+		{
+			name:    "none",
+			query:   "0.1",
+			match:   []string{"0.1"},
+			noMatch: []string{"0.10000000000000001"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tol, err := parseTolerance(tt.tolerance)
+			if err != nil {
+				t.Fatalf("parseTolerance(%q) error = %v", tt.tolerance, err)
+			}
+			q, err := parseValueQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseValueQuery(%q) error = %v", tt.query, err)
+			}
+			q = q.widen(tol)
+			for _, s := range tt.match {
+				if !q.match(lit(t, s)) {
+					t.Errorf("%q within %q does not match %s, want match", tt.query, tt.tolerance, s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if q.match(lit(t, s)) {
+					t.Errorf("%q within %q matches %s, want no match", tt.query, tt.tolerance, s)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseToleranceErrors(t *testing.T) {
+	for _, tolerance := range []string{"x", "-1", "-1%", "1i", "-2ulp", "NaNulp", "Infulp", "1,", "%"} {
+		if _, err := parseTolerance(tolerance); err == nil {
+			t.Errorf("parseTolerance(%q) error = nil, want error", tolerance)
+		}
+	}
+}